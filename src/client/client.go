@@ -0,0 +1,187 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An HTTP/1.1 client that keeps connections alive between requests to the same origin. It is safe for concurrent
+// use once configured.
+type Client struct {
+	// The time allowed for each exchange, from connecting to reading the whole response. Zero means no limit.
+	Timeout        time.Duration
+	IdleTimeout    time.Duration
+	MaxIdlePerHost int
+	MaxRedirects   int
+	MaxBodySize    int64
+
+	// Used for `https` URLs, with the server name taken from the URL unless it is set.
+	TLSConfig *tls.Config
+
+	idle     map[string][]*conn
+	idleLock sync.Mutex
+}
+
+func NewClient() *Client {
+	return &Client{
+		Timeout:        util.ClientDefaultTimeout,
+		IdleTimeout:    util.ClientDefaultIdleTimeout,
+		MaxIdlePerHost: util.ClientDefaultMaxIdlePerHost,
+		MaxRedirects:   util.ClientDefaultMaxRedirects,
+		MaxBodySize:    util.ClientDefaultMaxBodySize,
+	}
+}
+
+func (client *Client) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(&req)
+}
+
+// Sends a request and reads the response, following redirects up to the maximum. A redirect that would have to
+// send the body again is not followed, and its response is returned instead.
+func (client *Client) Do(req *http.Request) (*http.Response, error) {
+	if !req.Headers.Has(http.HeaderUserAgent) {
+		req.Headers.Set(http.HeaderUserAgent, util.ServerNameVersion)
+	}
+
+	for redirects := 0; ; redirects++ {
+		res, err := client.roundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		location, ok := res.Headers.Lookup(http.HeaderLocation)
+		if !ok || !isRedirect(res.StatusCode) {
+			return res, nil
+		}
+		next := redirectRequest(req, res.StatusCode, location)
+		if next == nil {
+			return res, nil
+		}
+		if redirects >= client.MaxRedirects {
+			return res, errors.New("too many redirects")
+		}
+		req = next
+	}
+}
+
+func (client *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	key := originKey(&req.Uri)
+	conn, reused := client.takeIdle(key), true
+	if conn == nil {
+		var err error
+		if conn, err = client.dial(&req.Uri); err != nil {
+			return nil, err
+		}
+		reused = false
+	}
+
+	received := conn.received
+	res, err := client.exchange(conn, req)
+	// The server may have closed an idle connection just before it was reused, so a request that can safely be sent
+	// again is retried once on a new connection, as long as nothing of a response arrived.
+	if err != nil && reused && req.Body == nil && isIdempotent(req.Method) && conn.received == received {
+		_ = conn.Close()
+		if conn, err = client.dial(&req.Uri); err != nil {
+			return nil, err
+		}
+		res, err = client.exchange(conn, req)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if res.WillCloseConnection() || req.WillCloseConnection() {
+		_ = conn.Close()
+	} else {
+		client.putIdle(key, conn)
+	}
+	return &res, nil
+}
+
+func (client *Client) exchange(conn *conn, req *http.Request) (http.Response, error) {
+	deadline := time.Time{}
+	if client.Timeout > 0 {
+		deadline = time.Now().Add(client.Timeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	err := req.Write(conn.writer)
+	var res http.Response
+	if err == nil {
+		res, err = http.ParseResponse(conn.Conn, conn.reader, req, client.MaxBodySize)
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		err = errors.New(util.ErrorTimeoutReached)
+	}
+	return res, err
+}
+
+func isIdempotent(method http.Method) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRedirect(status http.StatusCode) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// Creates the request that follows a redirect, or returns nil if it cannot be followed. `303 See Other` and, as
+// browsers do, a `POST` redirected with `301` or `302` become a `GET` without a body. Credentials are only sent
+// again to the same origin.
+func redirectRequest(req *http.Request, status http.StatusCode, location string) *http.Request {
+	ref, err := http.ParseUriReference(location)
+	if err != nil {
+		return nil
+	}
+	target := req.Uri.ResolveReference(&ref)
+	next, err := http.NewRequest(req.Method, target.String())
+	if err != nil {
+		return nil
+	}
+
+	dropBody := status == http.StatusSeeOther ||
+		req.Method == http.MethodPost && (status == http.StatusMovedPermanently || status == http.StatusFound)
+	if dropBody && req.Method != http.MethodHead {
+		next.Method = http.MethodGet
+	}
+	if req.Body != nil && !dropBody {
+		return nil
+	}
+
+	sameOrigin := originKey(&req.Uri) == originKey(&next.Uri)
+	req.Headers.Each(func(name string, value string) {
+		switch http.Header(strings.ToLower(name)) {
+		case http.HeaderHost, http.HeaderContentLength, http.HeaderTransferEncoding:
+			return
+		case http.HeaderContentType:
+			if dropBody {
+				return
+			}
+		case http.HeaderAuthorization, http.HeaderCookie:
+			if !sameOrigin {
+				return
+			}
+		}
+		next.Headers.Add(http.Header(name), value)
+	})
+	return &next
+}
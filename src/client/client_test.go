@@ -0,0 +1,127 @@
+package client
+
+import (
+	"bufio"
+	"net"
+	"segaline/src/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Serves one response per connection, and then answers the next request on it with the given reply before closing,
+// like a server that drops idle connections.
+type flakyServer struct {
+	listener net.Listener
+	reply    string
+	requests []string
+	lock     sync.Mutex
+}
+
+func newFlakyServer(t *testing.T, reply string) *flakyServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &flakyServer{listener: listener, reply: reply}
+	t.Cleanup(func() { _ = listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (server *flakyServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for index := 0; index < 2; index++ {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if !skipHeaders(reader) {
+					return
+				}
+				server.lock.Lock()
+				server.requests = append(server.requests, strings.Fields(line)[0])
+				server.lock.Unlock()
+
+				if index == 0 {
+					_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				} else {
+					_, _ = conn.Write([]byte(server.reply))
+				}
+			}
+		}()
+	}
+}
+
+func skipHeaders(reader *bufio.Reader) bool {
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		if header == "\r\n" {
+			return true
+		}
+	}
+}
+
+func (server *flakyServer) methods() string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return strings.Join(server.requests, " ")
+}
+
+func TestRetriesOnlySafeRequests(t *testing.T) {
+	cases := []struct {
+		name     string
+		method   http.Method
+		reply    string
+		ok       bool
+		requests string
+	}{
+		{"get on closed connection", http.MethodGet, "", true, "GET GET GET"},
+		{"post on closed connection", http.MethodPost, "", false, "GET POST"},
+		{"get after partial response", http.MethodGet, "HTTP/1.1 200 OK\r\nContent-Le", false, "GET GET"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := newFlakyServer(t, c.reply)
+			client := NewClient()
+			url := "http://" + server.listener.Addr().String() + "/"
+			if _, err := client.Get(url); err != nil {
+				t.Fatal(err)
+			}
+
+			req, _ := http.NewRequest(c.method, url)
+			_, err := client.Do(&req)
+			if (err == nil) != c.ok {
+				t.Errorf("expected success to be %v, got error %v", c.ok, err)
+			}
+			if methods := server.methods(); methods != c.requests {
+				t.Errorf("expected requests %q, got %q", c.requests, methods)
+			}
+		})
+	}
+}
+
+func TestResponseWithExpectHeader(t *testing.T) {
+	server := newFlakyServer(t, "HTTP/1.1 200 OK\r\nExpect: 100-continue\r\nContent-Length: 4\r\n\r\nbody")
+	client := NewClient()
+	url := "http://" + server.listener.Addr().String() + "/"
+	if _, err := client.Get(url); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Get(url)
+	if err != nil || string(res.Body) != "body" {
+		t.Errorf("expected body %q, got %q (%v)", "body", res.Body, err)
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	idleSince time.Time
+	received  int64
+}
+
+// Reads from the connection, counting the bytes so that a failed exchange shows whether the server sent anything.
+func (pooled *conn) Read(buf []byte) (int, error) {
+	n, err := pooled.Conn.Read(buf)
+	pooled.received += int64(n)
+	return n, err
+}
+
+// Identifies the origin of a URI, so that connections are only reused for the same scheme, host and port.
+func originKey(uri *http.Uri) string {
+	return string(uri.Scheme()) + "://" + strings.ToLower(uri.Host()) + ":" + strconv.Itoa(int(originPort(uri)))
+}
+
+func originPort(uri *http.Uri) uint16 {
+	switch {
+	case uri.Port() > 0:
+		return uri.Port()
+	case uri.Scheme() == http.SchemeHttps:
+		return 443
+	}
+	return 80
+}
+
+func (client *Client) dial(uri *http.Uri) (*conn, error) {
+	host := strings.TrimSuffix(strings.TrimPrefix(uri.Host(), "["), "]")
+	dialer := &net.Dialer{Timeout: client.Timeout}
+	netConn, err := dialer.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(originPort(uri)))))
+	if err != nil {
+		return nil, err
+	}
+
+	if uri.Scheme() == http.SchemeHttps {
+		config := &tls.Config{}
+		if client.TLSConfig != nil {
+			config = client.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+
+		tlsConn := tls.Client(netConn, config)
+		if client.Timeout > 0 {
+			_ = tlsConn.SetDeadline(time.Now().Add(client.Timeout))
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+		netConn = tlsConn
+	}
+
+	dialed := &conn{Conn: netConn, writer: bufio.NewWriterSize(netConn, util.ResponseWriterBufferSize)}
+	dialed.reader = bufio.NewReader(dialed)
+	return dialed, nil
+}
+
+// Takes the most recently used idle connection to an origin, closing any that have been idle for too long.
+func (client *Client) takeIdle(key string) *conn {
+	client.idleLock.Lock()
+	defer client.idleLock.Unlock()
+
+	conns := client.idle[key]
+	for len(conns) > 0 {
+		conn := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		if client.IdleTimeout <= 0 || time.Since(conn.idleSince) < client.IdleTimeout {
+			client.idle[key] = conns
+			return conn
+		}
+		_ = conn.Close()
+	}
+	delete(client.idle, key)
+	return nil
+}
+
+func (client *Client) putIdle(key string, pooled *conn) {
+	client.idleLock.Lock()
+	defer client.idleLock.Unlock()
+
+	if len(client.idle[key]) >= client.MaxIdlePerHost {
+		_ = pooled.Close()
+		return
+	}
+	if client.idle == nil {
+		client.idle = map[string][]*conn{}
+	}
+	pooled.idleSince = time.Now()
+	client.idle[key] = append(client.idle[key], pooled)
+}
+
+func (client *Client) CloseIdleConnections() {
+	client.idleLock.Lock()
+	defer client.idleLock.Unlock()
+
+	for _, conns := range client.idle {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+	client.idle = nil
+}
@@ -0,0 +1,163 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+)
+
+// A request body that is decoded from the connection as it is read, either by its `Content-Length` or in chunks.
+// A `100 Continue` response is only sent once the body is first read, so that a request can still be refused before
+// the client sends its body.
+type requestBody struct {
+	parser *requestParser
+
+	chunked   bool
+	remaining int64
+	read      int64
+	limit     int64
+
+	expectContinue bool
+	continueSent   bool
+
+	trailers Headers
+	eof      bool
+	closed   bool
+	err      error
+}
+
+func (body *requestBody) Read(buf []byte) (int, error) {
+	switch {
+	case body.err != nil:
+		return 0, body.err
+	case body.eof:
+		return 0, io.EOF
+	case body.closed:
+		return 0, errors.New("read from closed body")
+	}
+
+	if body.expectContinue && !body.continueSent {
+		body.continueSent = true
+		body.parser.sendContinue()
+	}
+
+	if body.chunked && body.remaining == 0 {
+		if body.err = body.nextChunk(); body.err != nil {
+			return 0, body.err
+		}
+		if body.eof {
+			return 0, io.EOF
+		}
+	}
+
+	if int64(len(buf)) > body.remaining {
+		buf = buf[:body.remaining]
+	}
+	n, err := body.parser.read(buf)
+	body.remaining -= int64(n)
+	body.read += int64(n)
+
+	if err == io.EOF && body.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		body.err = err
+		return n, err
+	}
+
+	if body.remaining == 0 {
+		if body.chunked {
+			if line, err := body.parser.readLine(); err != nil || line != "" {
+				body.err = errors.New("invalid chunk")
+			}
+		} else {
+			body.eof = true
+		}
+	}
+	return n, nil
+}
+
+func (body *requestBody) nextChunk() error {
+	line, err := body.parser.readLine()
+	if err != nil {
+		return err
+	}
+
+	rawSize := strings.TrimRight(strings.SplitN(line, ";", 2)[0], util.RequestOWS)
+	size, err := strconv.ParseInt(rawSize, 16, 64)
+	if err != nil || size < 0 || strings.HasPrefix(rawSize, "+") {
+		return errors.New("invalid chunk size")
+	}
+
+	if size == 0 {
+		if body.trailers, err = body.parser.parseHeaders(); err != nil {
+			return err
+		}
+		for _, name := range forbiddenTrailers {
+			if body.trailers.Has(name) {
+				return errors.New("invalid header in trailer")
+			}
+		}
+		body.eof = true
+		return nil
+	}
+
+	if body.limit >= 0 && body.read+size > body.limit {
+		return errors.New(util.ErrorContentLengthExceeded)
+	}
+	body.remaining = size
+	return nil
+}
+
+// Discards whatever is left of the body so that the next request on the connection can be read. Returns an error
+// if the body could not be fully drained, in which case the connection must be closed.
+func (body *requestBody) Close() error {
+	if body.closed {
+		return nil
+	}
+	defer func() { body.closed = true }()
+
+	if body.eof {
+		return nil
+	}
+	// The client is still waiting for permission to send the body, so it may never arrive.
+	if body.expectContinue && !body.continueSent {
+		return errors.New("request body was not sent")
+	}
+
+	drained, err := io.CopyN(ioutil.Discard, body, util.RequestMaxDrainLength+1)
+	if err != io.EOF {
+		if err == nil || drained > util.RequestMaxDrainLength {
+			err = errors.New("request body too large to drain")
+		}
+		return err
+	}
+	return nil
+}
+
+// Limits the size of the request body. If its length is known and too large, this fails immediately, and otherwise
+// reading fails once the limit is passed.
+func (req *Request) LimitBody(limit int64) error {
+	body, ok := req.Body.(*requestBody)
+	if !ok {
+		return nil
+	}
+
+	body.limit = limit
+	if req.ContentLength > limit {
+		body.err = errors.New(util.ErrorContentLengthExceeded)
+		return body.err
+	}
+	return nil
+}
+
+// Returns the trailer fields of a chunked body, which are only available once the body has been read to its end.
+func (req *Request) Trailers() Headers {
+	if body, ok := req.Body.(*requestBody); ok && body.eof {
+		return body.trailers
+	}
+	return Headers{}
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A cookie as sent by a client in a `Cookie` header, or set by the server with a `Set-Cookie` header. Only the name
+// and value are sent by clients, so the remaining attributes are only used when setting cookies.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Domain  string
+	Path    string
+	Expires time.Time
+
+	// A positive value is sent as `Max-Age`, a negative one as `Max-Age=0` to delete the cookie, and zero omits it.
+	MaxAge int
+
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Returns the cookies sent with the request in the order they appear. Pairs that are not valid are skipped, as
+// RFC 6265 asks of servers, rather than failing the whole header.
+func (req *Request) Cookies() []Cookie {
+	var cookies []Cookie
+	for _, header := range req.Headers.Values(HeaderCookie) {
+		for _, pair := range strings.Split(header, ";") {
+			parts := strings.SplitN(strings.Trim(pair, " \t"), "=", 2)
+			if len(parts) < 2 {
+				continue
+			}
+
+			cookie := Cookie{Name: parts[0], Value: parts[1]}
+			if isCookieName(cookie.Name) && isCookieValue(cookie.Value) {
+				cookie.Value = strings.TrimSuffix(strings.TrimPrefix(cookie.Value, `"`), `"`)
+				cookies = append(cookies, cookie)
+			}
+		}
+	}
+	return cookies
+}
+
+// Returns the first cookie with a name, since browsers send the cookie with the most specific path first.
+func (req *Request) Cookie(name string) (Cookie, bool) {
+	for _, cookie := range req.Cookies() {
+		if cookie.Name == name {
+			return cookie, true
+		}
+	}
+	return Cookie{}, false
+}
+
+// Adds a `Set-Cookie` header for a cookie. Each cookie is sent in its own header, so this can be called for as many
+// cookies as needed. Invalid cookies are not sent, since a browser would reject or misinterpret them.
+func (res *Response) WithCookie(cookie Cookie) *Response {
+	value, err := cookie.format()
+	if err != nil {
+		log.Println("An issue occurred while setting a cookie:", err)
+		return res
+	}
+	return res.WithHeaderAdded(HeaderSetCookie, value)
+}
+
+func (cookie *Cookie) Validate() error {
+	switch {
+	case !isCookieName(cookie.Name):
+		return errors.New("invalid cookie name")
+	case !isCookieValue(cookie.Value):
+		return errors.New("invalid cookie value")
+	case !isCookieAttributeValue(cookie.Domain) || !isCookieAttributeValue(cookie.Path):
+		return errors.New("invalid cookie attribute")
+	case cookie.Path != "" && !strings.HasPrefix(cookie.Path, "/"):
+		return errors.New("invalid cookie path")
+	}
+
+	switch cookie.SameSite {
+	case "", SameSiteStrict, SameSiteLax:
+	case SameSiteNone:
+		if !cookie.Secure {
+			return errors.New("same site none cookie must be secure")
+		}
+	default:
+		return errors.New("invalid cookie same site")
+	}
+	if cookie.Partitioned && !cookie.Secure {
+		return errors.New("partitioned cookie must be secure")
+	}
+	return nil
+}
+
+func (cookie *Cookie) format() (string, error) {
+	if err := cookie.Validate(); err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	builder.WriteString(cookie.Name + "=" + cookie.Value)
+	if cookie.Domain != "" {
+		builder.WriteString("; Domain=" + strings.TrimPrefix(cookie.Domain, "."))
+	}
+	if cookie.Path != "" {
+		builder.WriteString("; Path=" + cookie.Path)
+	}
+	if !cookie.Expires.IsZero() {
+		builder.WriteString("; Expires=" + formatTimeGMT(cookie.Expires))
+	}
+	if cookie.MaxAge > 0 {
+		builder.WriteString("; Max-Age=" + strconv.Itoa(cookie.MaxAge))
+	} else if cookie.MaxAge < 0 {
+		builder.WriteString("; Max-Age=0")
+	}
+	if cookie.Secure {
+		builder.WriteString("; Secure")
+	}
+	if cookie.HttpOnly {
+		builder.WriteString("; HttpOnly")
+	}
+	if cookie.SameSite != "" {
+		builder.WriteString("; SameSite=" + string(cookie.SameSite))
+	}
+	if cookie.Partitioned {
+		builder.WriteString("; Partitioned")
+	}
+	return builder.String(), nil
+}
+
+// Cookie names are tokens as defined by RFC 9110.
+func isCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, char := range name {
+		if char < 0x21 || char > 0x7E || strings.ContainsRune(`()<>@,;:\"/[]?={}`, char) {
+			return false
+		}
+	}
+	return true
+}
+
+// Cookie values are made of cookie-octets, optionally wrapped in double quotes.
+func isCookieValue(value string) bool {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	for _, char := range value {
+		if char < 0x21 || char > 0x7E || char == '"' || char == ',' || char == ';' || char == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func isCookieAttributeValue(value string) bool {
+	for _, char := range value {
+		if char < 0x20 || char > 0x7E || char == ';' {
+			return false
+		}
+	}
+	return true
+}
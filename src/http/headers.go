@@ -0,0 +1,141 @@
+package http
+
+import (
+	"sort"
+	"strings"
+)
+
+type headerField struct {
+	name  string
+	key   Header
+	value string
+}
+
+// An ordered, multi-valued collection of header fields. Names are matched case-insensitively, but each field keeps
+// the casing it was added or received with. The zero value is an empty collection ready to use.
+type Headers struct {
+	fields []headerField
+}
+
+// Returns the combined value of all fields with a name, joined with commas as RFC 9110 allows for list-based fields.
+// `Set-Cookie` cannot be combined this way, so only its first value is returned; use Values for all of them.
+func (headers *Headers) Get(name Header) string {
+	values := headers.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	if headerKey(string(name)) == HeaderSetCookie {
+		return values[0]
+	}
+	return strings.Join(values, ", ")
+}
+
+func (headers *Headers) Lookup(name Header) (string, bool) {
+	return headers.Get(name), headers.Has(name)
+}
+
+func (headers *Headers) Values(name Header) []string {
+	key := headerKey(string(name))
+
+	var values []string
+	for _, field := range headers.fields {
+		if field.key == key {
+			values = append(values, field.value)
+		}
+	}
+	return values
+}
+
+func (headers *Headers) Has(name Header) bool {
+	key := headerKey(string(name))
+	for _, field := range headers.fields {
+		if field.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (headers *Headers) Add(name Header, value string) {
+	headers.fields = append(headers.fields, headerField{string(name), headerKey(string(name)), value})
+}
+
+// Replaces all fields with a name by a single field, which keeps the position of the first one replaced.
+func (headers *Headers) Set(name Header, value string) {
+	key := headerKey(string(name))
+	fields := headers.fields[:0:0]
+	replaced := false
+
+	for _, field := range headers.fields {
+		if field.key != key {
+			fields = append(fields, field)
+		} else if !replaced {
+			fields = append(fields, headerField{string(name), key, value})
+			replaced = true
+		}
+	}
+	if !replaced {
+		fields = append(fields, headerField{string(name), key, value})
+	}
+	headers.fields = fields
+}
+
+func (headers *Headers) Del(name Header) {
+	key := headerKey(string(name))
+	fields := headers.fields[:0:0]
+	for _, field := range headers.fields {
+		if field.key != key {
+			fields = append(fields, field)
+		}
+	}
+	headers.fields = fields
+}
+
+func (headers *Headers) Len() int {
+	return len(headers.fields)
+}
+
+// Calls a function for each field in order, with the field's name in its original casing.
+func (headers *Headers) Each(f func(name string, value string)) {
+	for _, field := range headers.fields {
+		f(field.name, field.value)
+	}
+}
+
+// Returns the fields with the given names first, followed by the rest sorted by name. Fields with the same name keep
+// their relative order.
+func (headers *Headers) sortedFields(first ...Header) []headerField {
+	rank := func(key Header) int {
+		for index, name := range first {
+			if key == name {
+				return index
+			}
+		}
+		return len(first)
+	}
+
+	fields := append([]headerField{}, headers.fields...)
+	sort.SliceStable(fields, func(i, j int) bool {
+		rankI, rankJ := rank(fields[i].key), rank(fields[j].key)
+		if rankI != rankJ {
+			return rankI < rankJ
+		}
+		return fields[i].key < fields[j].key
+	})
+	return fields
+}
+
+func headerKey(name string) Header {
+	return Header(strings.ToLower(name))
+}
+
+// Removes the characters that would end a header field or status line early, so that a value taken from a request
+// can never add fields of its own to a message.
+func stripLineBreaks(str string) string {
+	if !strings.ContainsAny(str, "\r\n\x00") {
+		return str
+	}
+	return lineBreakStripper.Replace(str)
+}
+
+var lineBreakStripper = strings.NewReplacer("\r", "", "\n", "", "\x00", "")
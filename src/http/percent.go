@@ -0,0 +1,78 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The characters other than unreserved ones that may appear unencoded in each component. Query parameters also
+// encode the delimiters of `application/x-www-form-urlencoded`, so that names and values always round trip.
+var uriComponentChars = map[UriComponent]string{
+	UriComponentPath:        "!$&'()*+,;=:@/",
+	UriComponentPathSegment: "!$&'()*+,;=:@",
+	UriComponentQuery:       "!$&'()*+,;=:@/?",
+	UriComponentQueryParam:  "!$'()*,:@/?",
+	UriComponentUserInfo:    "!$&'()*+,;=:",
+	UriComponentFragment:    "!$&'()*+,;=:@/?",
+}
+
+// Percent-encodes every byte of a string that may not appear as is in a URI component. Non-ASCII characters are
+// encoded byte by byte from their UTF-8 form.
+func EncodePercent(str string, component UriComponent) string {
+	var builder strings.Builder
+	for index := 0; index < len(str); index++ {
+		if char := str[index]; isUnreserved(char) || strings.IndexByte(uriComponentChars[component], char) >= 0 {
+			builder.WriteByte(char)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", char))
+		}
+	}
+	return builder.String()
+}
+
+// Decodes percent-encoded octets, requiring the result to be valid UTF-8. Malformed encodings, overlong or otherwise
+// invalid UTF-8 sequences and encoded NULs are rejected, since they are commonly used to sneak past path checks.
+func DecodePercent(str string) (string, error) {
+	decoded := make([]byte, 0, len(str))
+	for index := 0; index < len(str); index++ {
+		if str[index] != '%' {
+			decoded = append(decoded, str[index])
+			continue
+		}
+
+		if index+2 >= len(str) {
+			return "", errors.New("malformed percent encoding")
+		}
+		octet, err := strconv.ParseUint(str[index+1:index+3], 16, 8)
+		if err != nil {
+			return "", errors.New("malformed percent encoding")
+		}
+		if octet == 0 {
+			return "", errors.New("encoded nul in percent encoding")
+		}
+		decoded = append(decoded, byte(octet))
+		index += 2
+	}
+
+	if !utf8.Valid(decoded) {
+		return "", errors.New("invalid utf-8 in percent encoding")
+	}
+	return string(decoded), nil
+}
+
+// No file name or path needs control characters, but they can split headers that a path is copied into.
+func isControl(char rune) bool {
+	return char < 0x20 || char == 0x7F
+}
+
+// Decodes a component that was already validated, falling back to the raw form if it is not valid after all.
+func decodePercent(str string) string {
+	decoded, err := DecodePercent(str)
+	if err != nil {
+		return str
+	}
+	return decoded
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"strings"
+)
+
+type queryParam struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// An ordered, multi-valued collection of query or form parameters. Parameters without a `=`, like `?debug`, are
+// flags whose value is empty. The zero value is an empty collection ready to use.
+type Query struct {
+	params []queryParam
+}
+
+// Decodes a query string or `application/x-www-form-urlencoded` body. In form mode, `+` is decoded as a space.
+func ParseQuery(raw string, form bool) (query Query, err error) {
+	if raw == "" {
+		return
+	}
+	for _, param := range strings.Split(raw, "&") {
+		if param == "" {
+			continue
+		}
+		if form {
+			param = strings.ReplaceAll(param, "+", " ")
+		}
+
+		nameAndValue := strings.SplitN(param, "=", 2)
+		decoded := queryParam{hasValue: len(nameAndValue) == 2}
+		if decoded.name, err = DecodePercent(nameAndValue[0]); err != nil {
+			return Query{}, err
+		}
+		if decoded.hasValue {
+			if decoded.value, err = DecodePercent(nameAndValue[1]); err != nil {
+				return Query{}, err
+			}
+		}
+		query.params = append(query.params, decoded)
+	}
+	return
+}
+
+// Returns the first value of a parameter, since that is what most applications expect of repeated parameters.
+func (query *Query) Get(name string) string {
+	value, _ := query.Lookup(name)
+	return value
+}
+
+func (query *Query) Lookup(name string) (string, bool) {
+	for _, param := range query.params {
+		if param.name == name {
+			return param.value, true
+		}
+	}
+	return "", false
+}
+
+func (query *Query) Values(name string) []string {
+	var values []string
+	for _, param := range query.params {
+		if param.name == name {
+			values = append(values, param.value)
+		}
+	}
+	return values
+}
+
+func (query *Query) Has(name string) bool {
+	_, ok := query.Lookup(name)
+	return ok
+}
+
+// Whether a parameter appears only as a flag, without any `=`.
+func (query *Query) IsFlag(name string) bool {
+	for _, param := range query.params {
+		if param.name == name && param.hasValue {
+			return false
+		}
+	}
+	return query.Has(name)
+}
+
+func (query *Query) Add(name string, value string) {
+	query.params = append(query.params, queryParam{name, value, true})
+}
+
+func (query *Query) Set(name string, value string) {
+	query.Del(name)
+	query.Add(name, value)
+}
+
+func (query *Query) Del(name string) {
+	params := query.params[:0:0]
+	for _, param := range query.params {
+		if param.name != name {
+			params = append(params, param)
+		}
+	}
+	query.params = params
+}
+
+func (query *Query) Len() int {
+	return len(query.params)
+}
+
+// Calls a function for each parameter in order.
+func (query *Query) Each(f func(name string, value string)) {
+	for _, param := range query.params {
+		f(param.name, param.value)
+	}
+}
+
+// Encodes the parameters in order, keeping flags without a `=`.
+func (query *Query) Encode() string {
+	encoded := make([]string, len(query.params))
+	for index, param := range query.params {
+		encoded[index] = EncodePercent(param.name, UriComponentQueryParam)
+		if param.hasValue {
+			encoded[index] += "=" + EncodePercent(param.value, UriComponentQueryParam)
+		}
+	}
+	return strings.Join(encoded, "&")
+}
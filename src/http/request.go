@@ -2,39 +2,198 @@ package http
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"segaline/src/util"
+	"strconv"
+	"strings"
 )
 
 type Request struct {
-	Method      Method
-	Uri         Uri
+	Method Method
+	Uri    Uri
+	// The target as it was received, which is kept when rewrite rules change the target that files are served from.
+	OriginalUri Uri
 	HttpVersion Version
 
-	Headers map[string]string
-	Body    []byte
+	Headers Headers
+
+	// This is never nil for parsed requests, and must be closed once the request has been handled so that the
+	// connection can be reused.
+	Body          io.ReadCloser
+	ContentLength int64
 
 	RemoteAddr net.Addr
+	RemoteUser string
+	ID         string
+
+	TLS               *tls.ConnectionState
+	ClientCertificate *x509.Certificate
+	ClientIdentity    string
 }
 
-func ParseRequest(conn net.Conn) (Request, error) {
-	parser := newRequestParser(bufio.NewReader(conn), bufio.NewWriter(conn))
-	return parser.parse(conn.RemoteAddr())
+// Parses the head of the next request from a connection. The same reader must be used for every request on a
+// connection, since it may have buffered the start of the next one.
+func ParseRequest(conn net.Conn, reader *bufio.Reader) (Request, error) {
+	parser := newRequestParser(conn, reader, bufio.NewWriter(conn))
+	req, err := parser.parse(conn.RemoteAddr())
+	req.ID = newRequestID()
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		req.TLS = &state
+		if len(state.VerifiedChains) > 0 {
+			req.ClientCertificate = state.PeerCertificates[0]
+			req.ClientIdentity = certificateIdentity(req.ClientCertificate)
+		}
+	}
+	return req, err
+}
+
+// The identity of the authenticated user or verified client certificate, if any, for logging.
+func (req *Request) Identity() string {
+	if req.RemoteUser != "" {
+		return req.RemoteUser
+	}
+	return req.ClientIdentity
+}
+
+// Creates a request to send to an absolute `http` or `https` URL, without the fragment.
+func NewRequest(method Method, target string) (Request, error) {
+	uri, err := ParseUriReference(target)
+	if err == nil && (uri.scheme != SchemeHttp && uri.scheme != SchemeHttps || uri.host == "") {
+		err = errors.New("unsupported scheme or missing host")
+	}
+	if err != nil {
+		return Request{}, err
+	}
+	uri.fragment, uri.hasFragment = "", false
+
+	return Request{
+		Method:      method,
+		Uri:         uri,
+		HttpVersion: Version11,
+		ID:          newRequestID(),
+	}, nil
+}
+
+func (req *Request) WithHeader(header Header, value string) *Request {
+	req.Headers.Set(header, value)
+	return req
+}
+
+func (req *Request) WithBody(body []byte, mediaType MediaType) *Request {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return req.WithHeader(HeaderContentType, string(mediaType))
 }
 
 func (req *Request) WillCloseConnection() bool {
-	value, ok := req.Headers[string(HeaderConnection)]
-	hasClose := ok && value == string(ConnectionHeaderClose)
-	isKeepAlive := req.HttpVersion == Version10 && ok && value == string(ConnectionHeaderKeepAlive)
-	return hasClose || req.HttpVersion < Version11 && !isKeepAlive
+	return willCloseConnection(req.Headers, req.HttpVersion)
 }
 
-func (req *Request) AsBytes() []byte {
-	headers := ""
-	for name, value := range req.Headers {
-		headers += name + ": " + value + "\r\n"
+// Decodes an `application/x-www-form-urlencoded` body. Any other content type is reported as unsupported, so that
+// handlers can respond accordingly.
+func (req *Request) Form() (Query, error) {
+	mediaType := strings.Trim(strings.SplitN(req.Headers.Get(HeaderContentType), ";", 2)[0], " \t")
+	if !strings.EqualFold(mediaType, string(MediaTypeForm)) {
+		return Query{}, errors.New(util.ErrorUnsupportedMediaType)
 	}
+	content, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return Query{}, err
+	}
+	return ParseQuery(string(content), true)
+}
 
-	str := fmt.Sprintf("%s %s %s\r\n%s\r\n%s", req.Method, &req.Uri, req.HttpVersion, headers, req.Body)
+// Serializes the head of the request as it was received, with header fields in their original order and casing.
+// The body is not included, since it is read from the connection separately.
+func (req *Request) AsBytes() []byte {
+	var headers strings.Builder
+	req.Headers.Each(func(name string, value string) {
+		headers.WriteString(name + ": " + value + "\r\n")
+	})
+
+	str := fmt.Sprintf("%s %s %s\r\n%s\r\n", req.Method, &req.OriginalUri, req.HttpVersion, headers.String())
 	return []byte(str)
 }
+
+// Writes the request to a server, with the target in origin form and a `Host` field from the URI unless the request
+// has one. The body is framed by its content length, or sent in chunks if its length is unknown.
+func (req *Request) Write(writer *bufio.Writer) error {
+	var head strings.Builder
+	head.WriteString(fmt.Sprintf("%s %s %s\r\n", req.Method, req.Uri.RequestTarget(), req.HttpVersion))
+	if !req.Headers.Has(HeaderHost) {
+		head.WriteString("Host: " + req.Uri.Authority() + "\r\n")
+	}
+	req.Headers.Each(func(name string, value string) {
+		if key := headerKey(name); key != HeaderContentLength && key != HeaderTransferEncoding {
+			head.WriteString(stripLineBreaks(name) + ": " + stripLineBreaks(value) + "\r\n")
+		}
+	})
+
+	chunked := req.Body != nil && req.ContentLength < 0
+	if chunked {
+		head.WriteString("Transfer-Encoding: chunked\r\n")
+	} else if req.Body != nil {
+		head.WriteString("Content-Length: " + strconv.FormatInt(req.ContentLength, 10) + "\r\n")
+	}
+	head.WriteString("\r\n")
+	if _, err := writer.WriteString(head.String()); err != nil {
+		return err
+	}
+
+	if chunked {
+		buf := make([]byte, util.ResponseChunkSize)
+		for {
+			n, err := req.Body.Read(buf)
+			if n > 0 {
+				if _, err := writer.WriteString(fmt.Sprintf("%x\r\n%s\r\n", n, buf[:n])); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := writer.WriteString("0\r\n\r\n"); err != nil {
+			return err
+		}
+	} else if req.Body != nil {
+		if _, err := io.CopyN(writer, req.Body, req.ContentLength); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func certificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.String()
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"net"
 	"segaline/src/util"
 	"strconv"
@@ -11,18 +12,41 @@ import (
 )
 
 type requestParser struct {
+	conn   net.Conn
 	reader *bufio.Reader
 	writer *bufio.Writer
 
+	// Without a read timeout, deadlines are left to the owner of the connection.
+	readTimeout time.Duration
+
 	method  Method
 	uri     Uri
-	headers map[string]string
+	headers Headers
+}
+
+// Fields whose values are not lists, so that a repeated field cannot be combined and the request is ambiguous.
+var singletonHeaders = []Header{
+	HeaderHost,
+	HeaderContentType,
+	HeaderAuthorization,
+	HeaderIfModifiedSince,
+	HeaderIfUnmodifiedSince,
 }
 
-func newRequestParser(reader *bufio.Reader, writer *bufio.Writer) requestParser {
-	return requestParser{
-		reader: reader,
-		writer: writer,
+// Fields that frame or route a message, which are not allowed in a trailer.
+var forbiddenTrailers = []Header{
+	HeaderHost,
+	HeaderContentLength,
+	HeaderTransferEncoding,
+	HeaderTrailer,
+}
+
+func newRequestParser(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer) *requestParser {
+	return &requestParser{
+		conn:        conn,
+		reader:      reader,
+		writer:      writer,
+		readTimeout: util.DefaultReadTimeout,
 	}
 }
 
@@ -37,23 +61,28 @@ func (parser *requestParser) parse(addr net.Addr) (request Request, err error) {
 	if err != nil {
 		return
 	}
-	if _, ok := parser.headers[string(HeaderHost)]; !ok {
+	if !parser.headers.Has(HeaderHost) && httpVersion == Version11 {
 		err = errors.New("missing host header")
+		return
 	}
 
-	// Trailer headers are checked for duplication but are ultimately ignored (as with most implementations).
-	body, trailer, err := parser.parseBody()
+	body, contentLength, err := parser.parseBody()
 	if err != nil {
 		return
 	}
-	for key := range trailer {
-		if _, ok := parser.headers[key]; ok {
-			err = errors.New("duplicate header in trailer")
-			return
-		}
-	}
-
-	return Request{parser.method, parser.uri, httpVersion, parser.headers, body, addr}, nil
+	// Only requests can ask for an interim response, since responses are parsed without a writer to send it with.
+	body.expectContinue = strings.EqualFold(parser.headers.Get(HeaderExpect), string(ExpectHeaderContinue))
+
+	return Request{
+		Method:        parser.method,
+		Uri:           parser.uri,
+		OriginalUri:   parser.uri,
+		HttpVersion:   httpVersion,
+		Headers:       parser.headers,
+		Body:          body,
+		ContentLength: contentLength,
+		RemoteAddr:    addr,
+	}, nil
 }
 
 func (parser *requestParser) parseRequestLine() (m Method, u Uri, v Version, err error) {
@@ -69,7 +98,8 @@ func (parser *requestParser) parseRequestLine() (m Method, u Uri, v Version, err
 
 	m = Method(parts[0])
 	switch m {
-	case MethodGet, MethodHead, MethodPost, MethodPut, MethodDelete, MethodConnect, MethodOptions, MethodTrace:
+	case MethodGet, MethodHead, MethodPost, MethodPut, MethodDelete, MethodConnect, MethodOptions, MethodTrace,
+		MethodPropfind, MethodProppatch, MethodMkcol, MethodCopy, MethodMove, MethodLock, MethodUnlock:
 	default:
 		err = errors.New(util.ErrorUnsupportedMethod)
 		return
@@ -90,9 +120,8 @@ func (parser *requestParser) parseRequestLine() (m Method, u Uri, v Version, err
 	return
 }
 
-func (parser *requestParser) parseHeaders() (headers map[string]string, err error) {
+func (parser *requestParser) parseHeaders() (headers Headers, err error) {
 	var line string
-	headers = map[string]string{}
 
 	for line, err = parser.readLine(); line != ""; line, err = parser.readLine() {
 		if err != nil {
@@ -105,111 +134,63 @@ func (parser *requestParser) parseHeaders() (headers map[string]string, err erro
 			return
 		}
 
-		name := normalizeCase(parts[0])
-		value := strings.Trim(normalizeCase(parts[1]), util.RequestOWS)
+		name := parts[0]
+		value := strings.Trim(parts[1], util.RequestOWS)
 		if !isVisibleString(name) || !isValidHeaderValue(value) {
 			err = errors.New("invalid header")
 			return
 		}
-
-		if _, ok := headers[name]; ok {
-			switch Header(name) {
-			case HeaderTransferEncoding, HeaderIfMatch, HeaderIfNoneMatch, HeaderIfModifiedSince,
-				HeaderIfUnmodifiedSince:
-				headers[name] += ", " + value
-			default:
-				err = errors.New("duplicate header")
-				return
-			}
-		} else {
-			headers[name] = value
-		}
+		headers.Add(Header(name), value)
 	}
-	return
-}
 
-func (parser *requestParser) parseBody() (body []byte, trailer map[string]string, err error) {
-	trailer = map[string]string{}
-
-	if rawEncodings, ok := parser.headers[string(HeaderTransferEncoding)]; ok {
-		if rawEncodings != string(TransferEncodingHeaderChunked) {
-			err = errors.New(util.ErrorUnsupportedTransferEncoding)
+	for _, name := range singletonHeaders {
+		if len(headers.Values(name)) > 1 {
+			err = errors.New("duplicate header")
 			return
 		}
-
-		parser.sendContinue()
-		body, trailer, err = parser.readChunked()
-	} else if contentLength, ok := parser.headers[string(HeaderContentLength)]; ok {
-		var length int
-		length, err = strconv.Atoi(contentLength)
-		if err != nil {
-			return
-		}
-		if length > util.RequestMaxContentLength {
-			err = errors.New(util.ErrorContentLengthExceeded)
-			return
+	}
+	// Repeated `Content-Length` fields are only allowed if they all agree, and are then treated as one.
+	if lengths := headers.Values(HeaderContentLength); len(lengths) > 1 {
+		for _, length := range lengths[1:] {
+			if length != lengths[0] {
+				err = errors.New("conflicting content length")
+				return
+			}
 		}
-
-		parser.sendContinue()
-		body, err = parser.readBytesFully(length)
+		headers.Set(HeaderContentLength, lengths[0])
 	}
 	return
 }
 
-func (parser *requestParser) readChunked() (body []byte, trailer map[string]string, err error) {
-	var chunkHeader string
-	chunkSize := int64(-1)
-
-	for chunkSize != 0 {
-		chunkHeader, err = parser.readLine()
-		if err != nil {
+// Sets up the body to be read lazily, according to its framing. Requests with both a `Content-Length` and
+// `Transfer-Encoding` are rejected, since intermediaries may disagree on which one applies.
+func (parser *requestParser) parseBody() (body *requestBody, contentLength int64, err error) {
+	body = &requestBody{parser: parser, limit: -1}
+
+	rawEncodings, chunked := parser.headers.Lookup(HeaderTransferEncoding)
+	rawLength, hasLength := parser.headers.Lookup(HeaderContentLength)
+	switch {
+	case chunked && hasLength:
+		err = errors.New("both content length and transfer encoding")
+	case chunked:
+		if !strings.EqualFold(rawEncodings, string(TransferEncodingHeaderChunked)) {
+			err = errors.New(util.ErrorUnsupportedTransferEncoding)
 			return
 		}
-
-		parts := strings.Split(chunkHeader, ";")
-		chunkSize, err = strconv.ParseInt(parts[0], 16, 32)
-		if err != nil || chunkSize > util.ResponseChunkSize {
-			err = errors.New("invalid chunk size")
+		body.chunked = true
+		contentLength = -1
+	case hasLength:
+		contentLength, err = strconv.ParseInt(rawLength, 10, 64)
+		if err != nil || contentLength < 0 || strings.Trim(rawLength, "0123456789") != "" {
+			err = errors.New("invalid content length")
 			return
 		}
-
-		if chunkSize > 0 {
-			var bytes []byte
-			bytes, err = parser.readBytesFully(int(chunkSize))
-			if line, readErr := parser.readLine(); readErr != nil || line != "" {
-				if readErr == nil {
-					err = errors.New("invalid chunk")
-				}
-				return
-			}
-			body = append(body, bytes...)
-		}
+		body.remaining = contentLength
 	}
-
-	trailer, err = parser.parseHeaders()
+	body.eof = !chunked && contentLength == 0
 	return
 }
 
-func (parser *requestParser) readBytesFully(bytesToRead int) ([]byte, error) {
-	var body []byte
-	totalRead := 0
-
-	for totalRead < bytesToRead {
-		bytes, _, err := parser.rawReadTimeout(
-			func() ([]byte, bool, error) {
-				b, err := parser.reader.ReadByte()
-				return []byte{b}, false, err
-			},
-		)
-		if err != nil {
-			return nil, err
-		}
-		body = append(body, bytes[0])
-		totalRead++
-	}
-	return body, nil
-}
-
 func (parser *requestParser) readLine() (string, error) {
 	line, isPrefix, err := parser.rawReadTimeout(parser.reader.ReadLine)
 	if err != nil {
@@ -229,48 +210,30 @@ func (parser *requestParser) readLine() (string, error) {
 	return string(fullLine), nil
 }
 
+// Runs a read with the read timeout as its deadline, so that slow clients cannot hold a connection forever.
 func (parser *requestParser) rawReadTimeout(f func() ([]byte, bool, error)) (line []byte, prefix bool, err error) {
-	lineChan := make(chan []byte)
-	prefixChan := make(chan bool)
-	errChan := make(chan error)
-
-	go func() {
-		// If the timeout is reached, the connection will be terminated and this call will fail, so this goroutine
-		// won't be blocked indefinitely.
-		line, isPrefix, err := f()
-		if err != nil {
-			errChan <- err
-		} else {
-			lineChan <- line
-			prefixChan <- isPrefix
-		}
-	}()
-
-	select {
-	case line = <-lineChan:
-		prefix = <-prefixChan
-	case err = <-errChan:
-	case <-time.After(util.DefaultReadTimeout):
+	if parser.conn != nil && parser.readTimeout > 0 {
+		_ = parser.conn.SetReadDeadline(time.Now().Add(parser.readTimeout))
+	}
+	line, prefix, err = f()
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 		err = errors.New(util.ErrorTimeoutReached)
 	}
 	return
 }
 
-func (parser *requestParser) sendContinue() {
-	if value := parser.headers[string(HeaderExpect)]; strings.EqualFold(value, string(ExpectHeaderContinue)) {
-		parser.respondStatus(parser.writer, StatusContinue, false)
-	}
+func (parser *requestParser) read(buf []byte) (n int, err error) {
+	_, _, err = parser.rawReadTimeout(func() ([]byte, bool, error) {
+		var readErr error
+		n, readErr = parser.reader.Read(buf)
+		return nil, false, readErr
+	})
+	return
 }
 
-func (parser *requestParser) respondStatus(writer *bufio.Writer, status StatusCode, closeConnection bool) {
-	req := Request{
-		Method: parser.method,
-		Uri:    parser.uri,
-	}
-
-	res := NewResponse(&req).WithStatus(status)
-	if closeConnection {
-		res.WithHeader(HeaderConnection, string(ConnectionHeaderClose))
-	}
-	res.Respond(writer)
+// The interim response is not logged, since the final response to the request is logged after it.
+func (parser *requestParser) sendContinue() {
+	statusLine := fmt.Sprintf("%s %d %s\r\n\r\n", Version11, StatusContinue, ReasonPhrase(StatusContinue))
+	writeFullyLog(parser.writer, []byte(statusLine))
+	flushLog(parser.writer)
 }
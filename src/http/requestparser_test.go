@@ -0,0 +1,50 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"segaline/src/util"
+	"testing"
+	"time"
+)
+
+func TestContinueIsNotLoggedAsResponse(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	_ = client.SetDeadline(time.Now().Add(util.TestResponseTimeout))
+	_ = server.SetDeadline(time.Now().Add(util.TestResponseTimeout))
+
+	interim := make(chan string, 1)
+	go func() {
+		_, _ = client.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\n" +
+			"Content-Length: 4\r\n\r\n"))
+		buf := make([]byte, len("HTTP/1.1 100 Continue\r\n\r\n"))
+		_, _ = io.ReadFull(client, buf)
+		interim <- string(buf)
+		_, _ = client.Write([]byte("body"))
+	}()
+
+	req, err := ParseRequest(server, bufio.NewReader(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := ioutil.ReadAll(req.Body); err != nil || string(body) != "body" {
+		t.Fatalf("expected body %q, got %q (%v)", "body", body, err)
+	}
+	if status := <-interim; status != "HTTP/1.1 100 Continue\r\n\r\n" {
+		t.Errorf("expected a bare interim status line, got %q", status)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("expected nothing to be logged, got %q", logged.String())
+	}
+}
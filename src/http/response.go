@@ -3,17 +3,20 @@ package http
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"segaline/src/util"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Response struct {
-	HttpVersion Version
-	StatusCode  StatusCode
+	HttpVersion  Version
+	StatusCode   StatusCode
+	ReasonPhrase string
 
-	Headers map[Header]string
+	Headers Headers
 	Body    []byte
 	Chunked bool
 
@@ -21,32 +24,41 @@ type Response struct {
 }
 
 func NewResponse(req *Request) *Response {
-	return &Response{
-		HttpVersion: Version11,
-		Headers: map[Header]string{
-			HeaderContentLength: "0",
-			HeaderServer:        util.ServerNameVersion,
-			HeaderDate:          formatTimeGMT(time.Now()),
-		},
-		request: req,
-	}
+	res := &Response{HttpVersion: Version11, request: req}
+	res.Headers.Set(HeaderContentLength, "0")
+	res.Headers.Set(HeaderServer, util.ServerNameVersion)
+	res.Headers.Set(HeaderDate, formatTimeGMT(time.Now()))
+	return res
 }
 
 func (res *Response) WithStatus(status StatusCode) *Response {
 	res.StatusCode = status
-	if int(status) < 200 || int(status) == 204 {
+	if int(status) < 200 || status == StatusNoContent || status == StatusNotModified {
 		res.WithoutHeader(HeaderContentLength)
 	}
 	return res
 }
 
+// Overrides the standard reason phrase sent for the response's status code.
+func (res *Response) WithReasonPhrase(phrase string) *Response {
+	res.ReasonPhrase = phrase
+	return res
+}
+
 func (res *Response) WithHeader(header Header, value string) *Response {
-	res.Headers[header] = value
+	res.Headers.Set(header, value)
+	return res
+}
+
+// Adds another field with the same name instead of replacing any existing ones, for headers such as `Set-Cookie`
+// that cannot be combined into a single line.
+func (res *Response) WithHeaderAdded(header Header, value string) *Response {
+	res.Headers.Add(header, value)
 	return res
 }
 
 func (res *Response) WithoutHeader(header Header) *Response {
-	delete(res.Headers, header)
+	res.Headers.Del(header)
 	return res
 }
 
@@ -64,14 +76,23 @@ func (res *Response) WithBody(body []byte, mediaType MediaType) *Response {
 	}
 }
 
+// Serializes the status line and headers. Headers are written with canonical casing in a deterministic order, with
+// `Date` and `Server` first and the rest sorted by name. Repeated fields are written on separate lines in the order
+// they were added.
 func (res *Response) AsBytesWithoutBody() []byte {
-	headers := ""
-	for name, value := range res.Headers {
-		headers += string(name) + ": " + value + "\r\n"
+	reasonPhrase := res.ReasonPhrase
+	if reasonPhrase == "" {
+		reasonPhrase = ReasonPhrase(res.StatusCode)
 	}
 
-	str := fmt.Sprintf("%s %d\r\n%s\r\n", res.HttpVersion, res.StatusCode, headers)
-	return []byte(str)
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("%s %d %s\r\n", res.HttpVersion, res.StatusCode, stripLineBreaks(reasonPhrase)))
+	for _, field := range res.Headers.sortedFields(HeaderDate, HeaderServer) {
+		name, value := stripLineBreaks(CanonicalHeaderName(field.name)), stripLineBreaks(field.value)
+		builder.WriteString(name + ": " + value + "\r\n")
+	}
+	builder.WriteString("\r\n")
+	return []byte(builder.String())
 }
 
 func (res *Response) AsBytes() []byte {
@@ -100,8 +121,49 @@ func (res *Response) Respond(writer *bufio.Writer) {
 		flushLog(writer)
 	}
 
+	res.log()
+}
+
+// Writes a response whose body is copied from a reader, for bodies of a known size that are too large to hold in
+// memory. If the body cannot be copied whole, the response is cut short, and the connection has to be closed.
+func (res *Response) RespondFrom(writer *bufio.Writer, body io.Reader, size int64) error {
+	res.WithHeader(HeaderContentLength, strconv.FormatInt(size, 10))
+	writeFullyLog(writer, res.AsBytesWithoutBody())
+	if _, err := io.CopyN(writer, body, size); err != nil {
+		log.Println("An issue occurred while responding to a request.")
+		return err
+	}
+	flushLog(writer)
+	res.log()
+	return nil
+}
+
+// Writes the status line and headers of a chunked response whose body is written afterwards with WriteChunk, for
+// bodies that are produced over time.
+func (res *Response) RespondStreamed(writer *bufio.Writer) {
+	res.Chunked = true
+	res.WithoutHeader(HeaderContentLength).WithHeader(HeaderTransferEncoding, string(TransferEncodingHeaderChunked))
+
+	writeFullyLog(writer, res.AsBytesWithoutBody())
+	flushLog(writer)
+	res.log()
+}
+
+// Writes and flushes a single chunk of a streamed response. An empty chunk ends the body.
+func WriteChunk(writer *bufio.Writer, chunk []byte) error {
+	if _, err := writeFully(writer, []byte(fmt.Sprintf("%x\r\n%s\r\n", len(chunk), chunk))); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+func (res *Response) log() {
 	if res.StatusCode != StatusRequestTimeout && res.StatusCode != StatusBadRequest {
-		log.Printf("(%d) %s %s %s\n", res.StatusCode, res.request.Method, &res.request.Uri, res.request.RemoteAddr)
+		user := res.request.Identity()
+		if user == "" {
+			user = "-"
+		}
+		log.Printf("(%d) %s %s %s %s\n", res.StatusCode, res.request.Method, &res.request.OriginalUri, res.request.RemoteAddr, user)
 	}
 }
 
@@ -0,0 +1,21 @@
+package http
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResponseHeadCannotBeSplit(t *testing.T) {
+	res := NewResponse(&Request{}).
+		WithStatus(StatusFound).
+		WithReasonPhrase("Found\r\nX-Injected: 1").
+		WithHeader(HeaderLocation, "/a\r\nSet-Cookie: x=1\x00")
+
+	head := string(res.AsBytesWithoutBody())
+	if strings.Count(head, "\r\n") != len(res.Headers.fields)+2 || strings.ContainsAny(head, "\x00") {
+		t.Errorf("expected one line per header, got %q", head)
+	}
+	if !strings.Contains(head, "\r\nLocation: /aSet-Cookie: x=1\r\n") {
+		t.Errorf("expected the line breaks to be removed from the location, got %q", head)
+	}
+}
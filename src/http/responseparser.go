@@ -0,0 +1,102 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+)
+
+// Parses the next response to a request from a connection, reading its whole body, which may not be larger than
+// maxBodySize. Interim responses are skipped. As with requests, the same reader must be used for every response on
+// a connection, and read deadlines are left to the caller.
+func ParseResponse(conn net.Conn, reader *bufio.Reader, req *Request, maxBodySize int64) (res Response, err error) {
+	parser := newRequestParser(conn, reader, nil)
+	parser.readTimeout = 0
+
+	for {
+		if res, err = parser.parseResponseHead(); err != nil {
+			return
+		}
+		if res.StatusCode >= StatusOK || res.StatusCode == StatusSwitchingProtocols {
+			break
+		}
+	}
+	res.request = req
+
+	if !res.hasBody() {
+		return
+	}
+	parser.headers = res.Headers
+	body, contentLength, err := parser.parseBody()
+	switch {
+	case err != nil:
+		return
+	case contentLength > maxBodySize:
+		err = errors.New(util.ErrorContentLengthExceeded)
+	case body.chunked || res.Headers.Has(HeaderContentLength):
+		body.limit = maxBodySize
+		res.Body, err = ioutil.ReadAll(body)
+	default:
+		// Without any framing, the body lasts until the server closes the connection.
+		res.Body, err = ioutil.ReadAll(io.LimitReader(reader, maxBodySize+1))
+		if err == nil && int64(len(res.Body)) > maxBodySize {
+			err = errors.New(util.ErrorContentLengthExceeded)
+		}
+	}
+	return
+}
+
+func (parser *requestParser) parseResponseHead() (res Response, err error) {
+	line, err := parser.readLine()
+	if err != nil {
+		return
+	}
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || Version(parts[0]) != Version10 && Version(parts[0]) != Version11 {
+		err = errors.New("invalid status line")
+		return
+	}
+	status, err := strconv.Atoi(parts[1])
+	if err != nil || len(parts[1]) != 3 || status < 100 {
+		err = errors.New("invalid status code")
+		return
+	}
+
+	res = Response{HttpVersion: Version(parts[0]), StatusCode: StatusCode(status)}
+	if len(parts) == 3 {
+		res.ReasonPhrase = parts[2]
+	}
+	res.Headers, err = parser.parseHeaders()
+	return
+}
+
+// Responses to `HEAD` requests and some statuses never have a body, whatever their headers say.
+func (res *Response) hasBody() bool {
+	if res.request != nil && res.request.Method == MethodHead {
+		return false
+	}
+	return res.StatusCode >= StatusOK && res.StatusCode != StatusNoContent && res.StatusCode != StatusNotModified
+}
+
+// Whether the connection a response was received on cannot be reused, because the server is closing it or the body
+// was delimited by closing it.
+func (res *Response) WillCloseConnection() bool {
+	closeDelimited := res.hasBody() && !res.Headers.Has(HeaderContentLength) && !res.Headers.Has(HeaderTransferEncoding)
+	return closeDelimited || willCloseConnection(res.Headers, res.HttpVersion)
+}
+
+func willCloseConnection(headers Headers, version Version) bool {
+	hasClose, hasKeepAlive := false, false
+	for _, option := range strings.Split(headers.Get(HeaderConnection), ",") {
+		option = strings.TrimSpace(option)
+		hasClose = hasClose || strings.EqualFold(option, string(ConnectionHeaderClose))
+		hasKeepAlive = hasKeepAlive || strings.EqualFold(option, string(ConnectionHeaderKeepAlive))
+	}
+	return hasClose || version < Version11 && !(version == Version10 && hasKeepAlive)
+}
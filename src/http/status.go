@@ -0,0 +1,76 @@
+package http
+
+var reasonPhrases = map[StatusCode]string{
+	StatusContinue:           "Continue",
+	StatusSwitchingProtocols: "Switching Protocols",
+	StatusProcessing:         "Processing",
+
+	StatusOK:                          "OK",
+	StatusCreated:                     "Created",
+	StatusAccepted:                    "Accepted",
+	StatusNonAuthoritativeInformation: "Non-Authoritative Information",
+	StatusNoContent:                   "No Content",
+	StatusResetContent:                "Reset Content",
+	StatusPartialContent:              "Partial Content",
+	StatusMultiStatus:                 "Multi-Status",
+	StatusAlreadyReported:             "Already Reported",
+	StatusIMUsed:                      "IM Used",
+
+	StatusMultipleChoices:   "Multiple Choices",
+	StatusMovedPermanently:  "Moved Permanently",
+	StatusFound:             "Found",
+	StatusSeeOther:          "See Other",
+	StatusNotModified:       "Not Modified",
+	StatusUseProxy:          "Use Proxy",
+	StatusTemporaryRedirect: "Temporary Redirect",
+	StatusPermanentRedirect: "Permanent Redirect",
+
+	StatusBadRequest:                      "Bad Request",
+	StatusUnauthorized:                    "Unauthorized",
+	StatusPaymentRequired:                 "Payment Required",
+	StatusForbidden:                       "Forbidden",
+	StatusNotFound:                        "Not Found",
+	StatusMethodNotAllowed:                "Method Not Allowed",
+	StatusNotAcceptable:                   "Not Acceptable",
+	StatusProxyAuthenticationRequired:     "Proxy Authentication Required",
+	StatusRequestTimeout:                  "Request Timeout",
+	StatusConflict:                        "Conflict",
+	StatusGone:                            "Gone",
+	StatusLengthRequired:                  "Length Required",
+	StatusPreconditionFailed:              "Precondition Failed",
+	StatusEntityTooLarge:                  "Content Too Large",
+	StatusRequestURITooLong:               "URI Too Long",
+	StatusUnsupportedMediaType:            "Unsupported Media Type",
+	StatusRequestedRangeNotSatisfiable:    "Range Not Satisfiable",
+	StatusExpectationFailed:               "Expectation Failed",
+	StatusImATeapot:                       "I'm a teapot",
+	StatusMisdirectedRequest:              "Misdirected Request",
+	StatusUnprocessableEntity:             "Unprocessable Content",
+	StatusLocked:                          "Locked",
+	StatusFailedDependency:                "Failed Dependency",
+	StatusUpgradeRequired:                 "Upgrade Required",
+	StatusPreconditionRequired:            "Precondition Required",
+	StatusTooManyRequests:                 "Too Many Requests",
+	StatusRequestHeaderFieldsTooLarge:     "Request Header Fields Too Large",
+	StatusConnectionClosedWithoutResponse: "Connection Closed Without Response",
+	StatusUnavailableForLegalReasons:      "Unavailable For Legal Reasons",
+	StatusClientClosedRequest:             "Client Closed Request",
+
+	StatusInternalServerError:           "Internal Server Error",
+	StatusNotImplemented:                "Not Implemented",
+	StatusBadGateway:                    "Bad Gateway",
+	StatusServiceUnavailable:            "Service Unavailable",
+	StatusGatewayTimeout:                "Gateway Timeout",
+	StatusHTTPVersionNotSupported:       "HTTP Version Not Supported",
+	StatusVariantAlsoNegotiates:         "Variant Also Negotiates",
+	StatusInsufficientStorage:           "Insufficient Storage",
+	StatusLoopDetected:                  "Loop Detected",
+	StatusNotExtended:                   "Not Extended",
+	StatusNetworkAuthenticationRequired: "Network Authentication Required",
+	StatusNetworkConnectTimeoutError:    "Network Connect Timeout Error",
+}
+
+// Returns the standard reason phrase for a status code, or an empty string for unknown codes.
+func ReasonPhrase(status StatusCode) string {
+	return reasonPhrases[status]
+}
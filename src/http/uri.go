@@ -7,75 +7,265 @@ import (
 	"strings"
 )
 
+// A URI reference as defined by RFC 3986. The path, query and fragment are kept in their percent-encoded form, and
+// the host keeps the brackets of IP literals.
 type Uri struct {
 	form Form
 
-	scheme Scheme
-	user   string
-	host   string
-	port   uint16
+	scheme       Scheme
+	hasAuthority bool
+	user         string
+	host         string
+	port         uint16
 
-	path  []string
-	query map[string]string
+	path        string
+	rawQuery    string
+	hasQuery    bool
+	fragment    string
+	hasFragment bool
 }
 
+// Parses the target of a request line, which may be in origin, absolute, authority or asterisk form. The result is
+// normalized, and paths whose decoded segments would escape their directory or contain control characters are
+// rejected.
 func ParseUri(method Method, raw string) (uri Uri, err error) {
 	if len(raw) > util.RequestMaxURILength {
 		err = errors.New(util.ErrorRequestURILengthExceeded)
 		return
 	}
 
-	if raw == "*" && method == MethodOptions {
-		return Uri{
-			form:   FormAsterisk,
-			scheme: SchemeHttp,
-		}, nil
-	}
-
-	if method == MethodConnect {
+	switch {
+	case raw == "*" && method == MethodOptions:
+		return Uri{form: FormAsterisk}, nil
+	case method == MethodConnect:
 		uri.user, uri.host, uri.port, err = parseAuthority(raw)
-		if uri.user != "" {
-			return uri, errors.New("authority with user info in connect request")
+		if err == nil && (uri.user != "" || uri.host == "" || uri.port == 0) {
+			err = errors.New("invalid authority in connect request")
 		}
+		uri.hasAuthority = true
 		uri.form = FormAuthority
-	} else if strings.HasPrefix(raw, "http:") || strings.HasPrefix(raw, "https:") {
-		uri, err = parseAbsoluteUri(raw)
-		if err != nil {
-			return
+		return
+	case strings.HasPrefix(raw, "/"):
+		// An origin form target is only a path and query, even if the path starts with two slashes.
+		uri.path = raw
+		if index := strings.Index(raw, "?"); index >= 0 {
+			uri.path, uri.rawQuery, uri.hasQuery = raw[:index], raw[index+1:], true
 		}
-		uri.form = FormAbsolute
-	} else if strings.HasPrefix(raw, "/") {
-		uri.path, uri.query, err = parseAbsolutePathWithQuery(raw)
-		if err != nil {
-			return
+		if !isPath(uri.path) || !isQuery(uri.rawQuery) {
+			err = errors.New("invalid path or query")
 		}
 		uri.form = FormOrigin
+	default:
+		uri, err = parseUriReference(raw)
+		if err == nil && (uri.scheme != SchemeHttp && uri.scheme != SchemeHttps || uri.host == "") {
+			err = errors.New("unsupported scheme or missing host")
+		}
+		uri.form = FormAbsolute
+	}
+	if err != nil {
+		return
+	}
+	if uri.hasFragment {
+		return uri, errors.New("fragment in request target")
 	}
+
+	uri = uri.Normalize()
+	for _, segment := range strings.Split(uri.path, "/") {
+		decoded, decodeErr := DecodePercent(segment)
+		if decodeErr != nil || strings.Contains(decoded, "/") || strings.IndexFunc(decoded, isControl) >= 0 {
+			return uri, errors.New("invalid or unsupported path segment")
+		}
+	}
+	_, err = ParseQuery(uri.rawQuery, false)
 	return
 }
 
+// Parses any URI reference, either absolute or relative, without normalizing it.
+func ParseUriReference(raw string) (Uri, error) {
+	if len(raw) > util.RequestMaxURILength {
+		return Uri{}, errors.New(util.ErrorRequestURILengthExceeded)
+	}
+	uri, err := parseUriReference(raw)
+	if uri.scheme != "" {
+		uri.form = FormAbsolute
+	}
+	return uri, err
+}
+
+func (uri *Uri) Form() Form {
+	return uri.form
+}
+
+func (uri *Uri) Scheme() Scheme {
+	return uri.scheme
+}
+
+func (uri *Uri) Host() string {
+	return uri.host
+}
+
+func (uri *Uri) Port() uint16 {
+	return uri.port
+}
+
+// Returns the decoded path, which is `/` if the path is empty.
 func (uri *Uri) PathString() string {
-	return "/" + strings.Join(uri.path, "/")
+	if uri.path == "" {
+		return "/"
+	}
+	return decodePercent(uri.path)
 }
 
-func (uri *Uri) String() string {
-	var user, port, path, query string
+func (uri *Uri) RawPath() string {
+	return uri.path
+}
+
+// Returns the first value of a query parameter, which is empty for flags like `?debug`.
+func (uri *Uri) Query(name string) (string, bool) {
+	query := uri.QueryParams()
+	return query.Lookup(name)
+}
+
+func (uri *Uri) QueryValues(name string) []string {
+	query := uri.QueryParams()
+	return query.Values(name)
+}
+
+// Returns all query parameters in order. A `+` is not decoded as a space, since that is only the case for forms;
+// use ParseQuery in form mode for queries submitted by HTML forms.
+func (uri *Uri) QueryParams() Query {
+	query, _ := ParseQuery(uri.rawQuery, false)
+	return query
+}
+
+func (uri *Uri) RawQuery() string {
+	return uri.rawQuery
+}
+
+func (uri *Uri) Fragment() string {
+	return decodePercent(uri.fragment)
+}
+
+// Whether the URI has a scheme, as opposed to being a relative reference.
+func (uri *Uri) IsAbsolute() bool {
+	return uri.scheme != ""
+}
 
-	if uri.user != "" {
-		user = encodePercent(uri.user + "@")
+// Returns the syntax based normalization of RFC 3986, section 6.2.2: the scheme and host are lowercased,
+// percent-encodings are normalized, dot segments are removed, and default ports and empty HTTP paths are replaced.
+func (uri *Uri) Normalize() Uri {
+	normalized := *uri
+	normalized.scheme = Scheme(strings.ToLower(string(uri.scheme)))
+	normalized.user = normalizePercent(uri.user)
+	normalized.host = normalizePercent(strings.ToLower(uri.host))
+	normalized.path = normalizePercent(uri.path)
+	normalized.rawQuery = normalizePercent(uri.rawQuery)
+	normalized.fragment = normalizePercent(uri.fragment)
+
+	if uri.form != FormAuthority {
+		normalized.path = removeDotSegments(normalized.path)
 	}
-	if uri.port > 0 {
-		port = ":" + strconv.Itoa(int(uri.port))
+	switch normalized.scheme {
+	case SchemeHttp, SchemeHttps:
+		if normalized.hasAuthority && normalized.path == "" {
+			normalized.path = "/"
+		}
+		if normalized.scheme == SchemeHttp && uri.port == 80 || normalized.scheme == SchemeHttps && uri.port == 443 {
+			normalized.port = 0
+		}
 	}
+	return normalized
+}
 
-	path = "/" + encodePercent(strings.Join(uri.path, "/"))
-	if len(uri.query) > 0 {
-		query = "?"
-		for name, value := range uri.query {
-			query += name + "=" + value + "&"
+// Compares two URIs after normalizing them.
+func (uri *Uri) Equal(other *Uri) bool {
+	normalized, otherNormalized := uri.Normalize(), other.Normalize()
+	return normalized.String() == otherNormalized.String()
+}
+
+// Resolves a reference relative to this URI as its base, following RFC 3986, section 5.2.2.
+func (uri *Uri) ResolveReference(ref *Uri) Uri {
+	target := *ref
+	if ref.scheme != "" {
+		target.path = removeDotSegments(ref.path)
+		return target
+	}
+
+	target.scheme = uri.scheme
+	target.form = uri.form
+	if ref.hasAuthority {
+		target.path = removeDotSegments(ref.path)
+		return target
+	}
+
+	target.hasAuthority, target.user, target.host, target.port = uri.hasAuthority, uri.user, uri.host, uri.port
+	switch {
+	case ref.path == "":
+		target.path = uri.path
+		if !ref.hasQuery {
+			target.rawQuery, target.hasQuery = uri.rawQuery, uri.hasQuery
 		}
-		query = query[:len(query)-1]
+	case strings.HasPrefix(ref.path, "/"):
+		target.path = removeDotSegments(ref.path)
+	case uri.hasAuthority && uri.path == "":
+		target.path = removeDotSegments("/" + ref.path)
+	default:
+		target.path = removeDotSegments(uri.path[:strings.LastIndex(uri.path, "/")+1] + ref.path)
 	}
+	return target
+}
 
-	return string(uri.scheme) + user + encodePercent(uri.host) + port + path + encodePercent(query)
+// Returns the target to send in a request line, which is only the path and query for absolute URIs.
+func (uri *Uri) RequestTarget() string {
+	if uri.form == FormAsterisk || uri.form == FormAuthority {
+		return uri.String()
+	}
+	target := uri.path
+	if target == "" {
+		target = "/"
+	}
+	if uri.hasQuery {
+		target += "?" + uri.rawQuery
+	}
+	return target
+}
+
+// Returns the host with the port, if the URI has one, as sent in the `Host` header.
+func (uri *Uri) Authority() string {
+	if uri.port > 0 {
+		return uri.host + ":" + strconv.Itoa(int(uri.port))
+	}
+	return uri.host
+}
+
+// Recomposes the URI as in RFC 3986, section 5.3.
+func (uri *Uri) String() string {
+	if uri.form == FormAsterisk {
+		return "*"
+	}
+
+	var builder strings.Builder
+	if uri.scheme != "" {
+		builder.WriteString(string(uri.scheme) + ":")
+	}
+	if uri.hasAuthority {
+		if uri.form != FormAuthority {
+			builder.WriteString("//")
+		}
+		if uri.user != "" {
+			builder.WriteString(uri.user + "@")
+		}
+		builder.WriteString(uri.host)
+		if uri.port > 0 {
+			builder.WriteString(":" + strconv.Itoa(int(uri.port)))
+		}
+	}
+	builder.WriteString(uri.path)
+	if uri.hasQuery {
+		builder.WriteString("?" + uri.rawQuery)
+	}
+	if uri.hasFragment {
+		builder.WriteString("#" + uri.fragment)
+	}
+	return builder.String()
 }
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+// The conformance corpus lives in testdata/uri. Expected values that are omitted from a case are not checked.
+
+type referenceCase struct {
+	Input      string
+	Valid      bool
+	Scheme     *string
+	Host       *string
+	Port       *uint16
+	Path       *string
+	Query      *string
+	Fragment   *string
+	String     *string
+	Normalized *string
+}
+
+type resolutionCorpus struct {
+	Base  string
+	Cases []struct {
+		Reference string
+		Target    string
+	}
+}
+
+type targetCase struct {
+	Method Method
+	Target string
+	Valid  bool
+	Path   *string
+	String *string
+}
+
+func loadCorpus(t *testing.T, name string, corpus interface{}) {
+	content, err := ioutil.ReadFile("testdata/uri/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, corpus); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectString(t *testing.T, input string, component string, expected *string, actual string) {
+	t.Helper()
+	if expected != nil && *expected != actual {
+		t.Errorf("%q: expected %s %q, got %q", input, component, *expected, actual)
+	}
+}
+
+func TestParseUriReference(t *testing.T) {
+	var cases []referenceCase
+	loadCorpus(t, "references.json", &cases)
+
+	for _, c := range cases {
+		uri, err := ParseUriReference(c.Input)
+		if (err == nil) != c.Valid {
+			t.Errorf("%q: expected valid to be %t, got error %v", c.Input, c.Valid, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		expectString(t, c.Input, "scheme", c.Scheme, string(uri.Scheme()))
+		expectString(t, c.Input, "host", c.Host, uri.Host())
+		expectString(t, c.Input, "path", c.Path, uri.RawPath())
+		expectString(t, c.Input, "query", c.Query, uri.RawQuery())
+		expectString(t, c.Input, "fragment", c.Fragment, uri.fragment)
+		expectString(t, c.Input, "string", c.String, uri.String())
+		normalized := uri.Normalize()
+		expectString(t, c.Input, "normalized", c.Normalized, normalized.String())
+		if c.Port != nil && *c.Port != uri.Port() {
+			t.Errorf("%q: expected port %d, got %d", c.Input, *c.Port, uri.Port())
+		}
+		if !uri.Equal(&normalized) {
+			t.Errorf("%q: expected to equal its normalization %q", c.Input, normalized.String())
+		}
+	}
+}
+
+func TestResolveReference(t *testing.T) {
+	var corpus resolutionCorpus
+	loadCorpus(t, "resolution.json", &corpus)
+
+	base, err := ParseUriReference(corpus.Base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range corpus.Cases {
+		ref, err := ParseUriReference(c.Reference)
+		if err != nil {
+			t.Errorf("%q: %v", c.Reference, err)
+			continue
+		}
+		target := base.ResolveReference(&ref)
+		if target.String() != c.Target {
+			t.Errorf("%q: expected %q, got %q", c.Reference, c.Target, target.String())
+		}
+	}
+}
+
+func TestParseRequestTarget(t *testing.T) {
+	var cases []targetCase
+	loadCorpus(t, "targets.json", &cases)
+
+	for _, c := range cases {
+		uri, err := ParseUri(c.Method, c.Target)
+		if (err == nil) != c.Valid {
+			t.Errorf("%s %q: expected valid to be %t, got error %v", c.Method, c.Target, c.Valid, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		expectString(t, c.Target, "path", c.Path, uri.PathString())
+		expectString(t, c.Target, "string", c.String, uri.String())
+	}
+}
+
+var uriComponents = map[string]UriComponent{
+	"path":        UriComponentPath,
+	"pathSegment": UriComponentPathSegment,
+	"query":       UriComponentQuery,
+	"queryParam":  UriComponentQueryParam,
+	"userInfo":    UriComponentUserInfo,
+	"fragment":    UriComponentFragment,
+}
+
+func TestPercentEncoding(t *testing.T) {
+	var cases []struct {
+		Decoded   string
+		Component string
+		Encoded   string
+	}
+	loadCorpus(t, "encoding.json", &cases)
+
+	for _, c := range cases {
+		if encoded := EncodePercent(c.Decoded, uriComponents[c.Component]); encoded != c.Encoded {
+			t.Errorf("%q: expected %s encoding %q, got %q", c.Decoded, c.Component, c.Encoded, encoded)
+		}
+		if decoded, err := DecodePercent(c.Encoded); err != nil || decoded != c.Decoded {
+			t.Errorf("%q: expected decoding %q, got %q (%v)", c.Encoded, c.Decoded, decoded, err)
+		}
+	}
+}
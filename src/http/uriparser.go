@@ -3,132 +3,160 @@ package http
 import (
 	"errors"
 	"math"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
-var hostNameChars = regexp.MustCompile(`^[a-zA-Z\-._~%!$&'()*+,;=]*$`)
-var ipAddress = regexp.MustCompile("^" + strings.Repeat(`\.(\d|\d\d|1\d\d|2[0-4]\d|25[0-6])`, 4)[1:] + "$")
-var userInfoChars = regexp.MustCompile(`^[a-zA-Z\-._~%!$&'()*+,;=:]*$`)
-var pathChars = regexp.MustCompile(`^[a-zA-Z\-._~%!$&'()*+,;=:@]*$`)
-var queryChars = regexp.MustCompile(`^[a-zA-Z\-._~%!$&'()*+,;=:@/?]*$`)
-
-func parseAbsoluteUri(raw string) (uri Uri, err error) {
-	if len(raw) < 5 || raw[:4] != string(SchemeHttp) && raw[:5] != string(SchemeHttps) {
-		err = errors.New("unsupported scheme")
-		return
+var schemeChars = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+\-.]*$`)
+var userInfoChars = regexp.MustCompile(`^([a-zA-Z0-9\-._~!$&'()*+,;=:]|%[0-9a-fA-F]{2})*$`)
+var regNameChars = regexp.MustCompile(`^([a-zA-Z0-9\-._~!$&'()*+,;=]|%[0-9a-fA-F]{2})*$`)
+var ipvFuture = regexp.MustCompile(`^[vV][0-9a-fA-F]+\.[a-zA-Z0-9\-._~!$&'()*+,;=:]+$`)
+var pathChars = regexp.MustCompile(`^([a-zA-Z0-9\-._~!$&'()*+,;=:@/]|%[0-9a-fA-F]{2})*$`)
+var queryChars = regexp.MustCompile(`^([a-zA-Z0-9\-._~!$&'()*+,;=:@/?]|%[0-9a-fA-F]{2})*$`)
+
+// Splits a URI reference into its components as in appendix B of RFC 3986, and validates each of them.
+func parseUriReference(raw string) (uri Uri, err error) {
+	if index := strings.Index(raw, "#"); index >= 0 {
+		uri.fragment, uri.hasFragment = raw[index+1:], true
+		raw = raw[:index]
 	}
-
-	var scheme Scheme
-	switch raw[4] {
-	case ':':
-		scheme = SchemeHttp
-	case 's':
-		scheme = SchemeHttps
+	if index := strings.Index(raw, "?"); index >= 0 {
+		uri.rawQuery, uri.hasQuery = raw[index+1:], true
+		raw = raw[:index]
 	}
 
-	raw = raw[strings.Index(raw, ":")+1:]
-	var user, host string
-	var port uint16
-	var path []string
-	var query map[string]string
+	if colon := strings.Index(raw, ":"); colon >= 0 && !strings.Contains(raw[:colon], "/") {
+		if !schemeChars.MatchString(raw[:colon]) {
+			err = errors.New("invalid scheme")
+			return
+		}
+		uri.scheme = Scheme(strings.ToLower(raw[:colon]))
+		raw = raw[colon+1:]
+	}
 
-	if len(raw) > 2 && raw[0:2] == "//" {
+	if strings.HasPrefix(raw, "//") {
 		raw = raw[2:]
-		pathStart := strings.Index(raw, "/")
-		if pathStart > 0 {
-			user, host, port, err = parseAuthority(raw[:pathStart])
-			if err != nil {
-				return
-			}
-			path, query, err = parseAbsolutePathWithQuery(raw[pathStart:])
-		} else {
-			user, host, port, err = parseAuthority(raw)
+		authorityEnd := strings.Index(raw, "/")
+		if authorityEnd < 0 {
+			authorityEnd = len(raw)
 		}
-	} else if raw[0] == '/' {
-		path, query, err = parseAbsolutePathWithQuery(raw)
-	} else {
-		path, query, err = parseAbsolutePathWithQuery("/" + raw)
+		uri.user, uri.host, uri.port, err = parseAuthority(raw[:authorityEnd])
+		if err != nil {
+			return
+		}
+		uri.hasAuthority = true
+		raw = raw[authorityEnd:]
 	}
 
-	uri = Uri{FormAbsolute, scheme, user, host, port, path, query}
+	if !isPath(raw) {
+		err = errors.New("invalid path")
+		return
+	}
+	if !isQuery(uri.rawQuery) || !isQuery(uri.fragment) {
+		err = errors.New("invalid query or fragment")
+		return
+	}
+	uri.path = raw
 	return
 }
 
 func parseAuthority(raw string) (user string, host string, port uint16, err error) {
-	userAndRest := strings.SplitN(raw, "@", 2)
-	var rest string
-	if len(userAndRest) < 2 {
-		rest = userAndRest[0]
-	} else {
-		if !isUserInfo(userAndRest[0]) {
+	if at := strings.Index(raw, "@"); at >= 0 {
+		if !isUserInfo(raw[:at]) {
 			err = errors.New("invalid user info")
 			return
 		}
-		user = decodePercent(userAndRest[0])
-		rest = userAndRest[1]
+		user = raw[:at]
+		raw = raw[at+1:]
 	}
 
-	hostAndPort := strings.Split(rest, ":")
-	host = hostAndPort[0]
-	if len(hostAndPort) > 1 {
-		var maybePort int
-
-		host = strings.Join(hostAndPort[0:len(hostAndPort)-1], "")
-		maybePort, err = strconv.Atoi(hostAndPort[len(hostAndPort)-1])
+	rawPort := ""
+	if strings.HasPrefix(raw, "[") {
+		end := strings.Index(raw, "]")
+		if end < 0 || !isIPLiteral(raw[1:end]) {
+			err = errors.New("invalid ip literal")
+			return
+		}
+		host, raw = raw[:end+1], raw[end+1:]
+		if raw != "" && !strings.HasPrefix(raw, ":") {
+			err = errors.New("invalid host")
+			return
+		}
+		rawPort = strings.TrimPrefix(raw, ":")
+	} else {
+		host = raw
+		if colon := strings.LastIndex(raw, ":"); colon >= 0 {
+			host, rawPort = raw[:colon], raw[colon+1:]
+		}
+		if !isHostName(host) {
+			err = errors.New("invalid host")
+			return
+		}
+	}
 
-		if err != nil || maybePort < 0 || maybePort > math.MaxUint16 {
+	if rawPort != "" {
+		maybePort, convErr := strconv.Atoi(rawPort)
+		if convErr != nil || strings.Trim(rawPort, "0123456789") != "" || maybePort > math.MaxUint16 {
 			err = errors.New("invalid port")
 			return
 		}
 		port = uint16(maybePort)
 	}
-
-	if !isHostName(host) && !isIPAddress(host) {
-		err = errors.New("invalid host")
-	}
-	host = decodePercent(host)
 	return
 }
 
-func parseAbsolutePathWithQuery(raw string) (path []string, query map[string]string, err error) {
-	query = map[string]string{}
-
-	pathAndQuery := strings.SplitN(raw, "?", 2)
-	stringPath, stringQuery := pathAndQuery[0], ""
-	if len(pathAndQuery) > 1 {
-		stringQuery = pathAndQuery[1]
-	}
-
-	if strings.Contains(stringPath, "//") {
-		err = errors.New("empty intermediate path segment")
-		return
-	}
-
-	pathParts := strings.Split(strings.TrimPrefix(strings.TrimSuffix(stringPath, "/"), "/"), "/")
-	for _, part := range pathParts {
-		if !isPath(part) || part == ".." || strings.EqualFold(part, "%2e%2e") {
-			err = errors.New("invalid or unsupported path segment")
-			return
+// Implements the remove_dot_segments algorithm of RFC 3986, section 5.2.4.
+func removeDotSegments(path string) string {
+	segments := strings.Split(path, "/")
+	var output []string
+
+	for index, segment := range segments {
+		switch segment {
+		case ".":
+		case "..":
+			if len(output) > 1 || len(output) == 1 && output[0] != "" {
+				output = output[:len(output)-1]
+			}
+		default:
+			output = append(output, segment)
+			continue
+		}
+		if index == len(segments)-1 {
+			output = append(output, "")
 		}
-		path = append(path, decodePercent(part))
 	}
+	return strings.Join(output, "/")
+}
 
-	if len(stringQuery) == 0 {
-		return
-	}
+// Normalizes percent-encoded octets by uppercasing their hex digits, and decoding them if they are unreserved.
+func normalizePercent(str string) string {
+	var builder strings.Builder
+	for index := 0; index < len(str); index++ {
+		if str[index] != '%' || index+2 >= len(str) {
+			builder.WriteByte(str[index])
+			continue
+		}
 
-	queryParts := strings.Split(stringQuery, "&")
-	for _, param := range queryParts {
-		nameAndValue := strings.SplitN(param, "=", 2)
-		if len(nameAndValue) < 2 || !isQuery(param) {
-			err = errors.New("invalid query parameter")
-			return
+		octet, err := strconv.ParseUint(str[index+1:index+3], 16, 8)
+		if err != nil {
+			builder.WriteByte(str[index])
+			continue
 		}
-		query[decodePercent(nameAndValue[0])] = decodePercent(nameAndValue[1])
+		if isUnreserved(byte(octet)) {
+			builder.WriteByte(byte(octet))
+		} else {
+			builder.WriteString("%" + strings.ToUpper(str[index+1:index+3]))
+		}
+		index += 2
 	}
-	return
+	return builder.String()
+}
+
+func isUnreserved(char byte) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' ||
+		strings.IndexByte("-._~", char) >= 0
 }
 
 func isQuery(str string) bool {
@@ -143,10 +171,15 @@ func isUserInfo(str string) bool {
 	return userInfoChars.MatchString(str)
 }
 
-func isIPAddress(str string) bool {
-	return ipAddress.MatchString(str)
+// An IPv6 address or an IPvFuture literal, without the surrounding brackets.
+func isIPLiteral(str string) bool {
+	if ipvFuture.MatchString(str) {
+		return true
+	}
+	return strings.Contains(str, ":") && net.ParseIP(str) != nil
 }
 
+// Registered names include IPv4 addresses syntactically, so this accepts both.
 func isHostName(str string) bool {
-	return hostNameChars.MatchString(str)
+	return regNameChars.MatchString(str)
 }
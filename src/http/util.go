@@ -1,9 +1,6 @@
 package http
 
 import (
-	"fmt"
-	"math"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -16,6 +13,8 @@ type Header string
 type ConnectionHeader string
 type TransferEncodingHeader string
 type ExpectHeader string
+type AuthScheme string
+type SameSite string
 
 const (
 	MethodGet     Method = "GET"
@@ -26,6 +25,14 @@ const (
 	MethodConnect Method = "CONNECT"
 	MethodOptions Method = "OPTIONS"
 	MethodTrace   Method = "TRACE"
+
+	MethodPropfind  Method = "PROPFIND"
+	MethodProppatch Method = "PROPPATCH"
+	MethodMkcol     Method = "MKCOL"
+	MethodCopy      Method = "COPY"
+	MethodMove      Method = "MOVE"
+	MethodLock      Method = "LOCK"
+	MethodUnlock    Method = "UNLOCK"
 )
 
 const (
@@ -54,8 +61,8 @@ const (
 	StatusSeeOther
 	StatusNotModified
 	StatusUseProxy
-	StatusTemporaryRedirect
-	StatusPermanentRedirect
+	StatusTemporaryRedirect StatusCode = 307
+	StatusPermanentRedirect StatusCode = 308
 )
 
 const (
@@ -113,41 +120,43 @@ const (
 )
 
 const (
-	MediaTypeAAC        MediaType = "audio/aac"
-	MediaTypeAVI        MediaType = "video/x-msvideo"
-	MediaTypeBinary     MediaType = "application/octet-stream"
-	MediaTypeBitmap     MediaType = "image/bmp"
-	MediaTypeCSS        MediaType = "text/css"
-	MediaTypeCSV        MediaType = "text/csv"
-	MediaTypeEPUB       MediaType = "application/epub+zip"
-	MediaTypeGZip       MediaType = "application/gzip"
-	MediaTypeGIF        MediaType = "image/gif"
-	MediaTypeHTML       MediaType = "text/html"
-	MediaTypeHTTP       MediaType = "message/http"
-	MediaTypeIcon       MediaType = "image/vnd.microsoft.icon"
-	MediaTypeJPEG       MediaType = "image/jpeg"
-	MediaTypeJavaScript MediaType = "text/javascript"
-	MediaTypeJSON       MediaType = "application/json"
-	MediaTypeMP3        MediaType = "audio/mpeg"
-	MediaTypeMP4        MediaType = "video/mp4"
-	MediaTypeOGGAudio   MediaType = "audio/ogg"
-	MediaTypePNG        MediaType = "image/png"
-	MediaTypePDF        MediaType = "application/pdf"
-	MediaTypePHP        MediaType = "application/php"
-	MediaTypeRTF        MediaType = "application/rtf"
-	MediaTypeSVG        MediaType = "image/svg+xml"
-	MediaTypeSWF        MediaType = "application/x-shockwave-flash"
-	MediaTypeTTF        MediaType = "font/ttf"
-	MediaTypeText       MediaType = "text/plain"
-	MediaTypeWAV        MediaType = "audio/wav"
-	MediaTypeWEBMAudio  MediaType = "audio/webm"
-	MediaTypeWEBMVideo  MediaType = "video/webm"
-	MediaTypeWEBPImage  MediaType = "image/webp"
-	MediaTypeWOFF       MediaType = "font/woff"
-	MediaTypeWOFF2      MediaType = "font/woff2"
-	MediaTypeXHTML      MediaType = "application/xhtml+xml"
-	MediaTypeXML        MediaType = "application/xml"
-	MediaTypeZip        MediaType = "application/zip"
+	MediaTypeAAC         MediaType = "audio/aac"
+	MediaTypeAVI         MediaType = "video/x-msvideo"
+	MediaTypeBinary      MediaType = "application/octet-stream"
+	MediaTypeBitmap      MediaType = "image/bmp"
+	MediaTypeCSS         MediaType = "text/css"
+	MediaTypeCSV         MediaType = "text/csv"
+	MediaTypeEPUB        MediaType = "application/epub+zip"
+	MediaTypeEventStream MediaType = "text/event-stream"
+	MediaTypeForm        MediaType = "application/x-www-form-urlencoded"
+	MediaTypeGZip        MediaType = "application/gzip"
+	MediaTypeGIF         MediaType = "image/gif"
+	MediaTypeHTML        MediaType = "text/html"
+	MediaTypeHTTP        MediaType = "message/http"
+	MediaTypeIcon        MediaType = "image/vnd.microsoft.icon"
+	MediaTypeJPEG        MediaType = "image/jpeg"
+	MediaTypeJavaScript  MediaType = "text/javascript"
+	MediaTypeJSON        MediaType = "application/json"
+	MediaTypeMP3         MediaType = "audio/mpeg"
+	MediaTypeMP4         MediaType = "video/mp4"
+	MediaTypeOGGAudio    MediaType = "audio/ogg"
+	MediaTypePNG         MediaType = "image/png"
+	MediaTypePDF         MediaType = "application/pdf"
+	MediaTypePHP         MediaType = "application/php"
+	MediaTypeRTF         MediaType = "application/rtf"
+	MediaTypeSVG         MediaType = "image/svg+xml"
+	MediaTypeSWF         MediaType = "application/x-shockwave-flash"
+	MediaTypeTTF         MediaType = "font/ttf"
+	MediaTypeText        MediaType = "text/plain"
+	MediaTypeWAV         MediaType = "audio/wav"
+	MediaTypeWEBMAudio   MediaType = "audio/webm"
+	MediaTypeWEBMVideo   MediaType = "video/webm"
+	MediaTypeWEBPImage   MediaType = "image/webp"
+	MediaTypeWOFF        MediaType = "font/woff"
+	MediaTypeWOFF2       MediaType = "font/woff2"
+	MediaTypeXHTML       MediaType = "application/xhtml+xml"
+	MediaTypeXML         MediaType = "application/xml"
+	MediaTypeZip         MediaType = "application/zip"
 )
 
 const (
@@ -166,6 +175,45 @@ const (
 	HeaderIfNoneMatch       Header = "if-none-match"
 	HeaderIfModifiedSince   Header = "if-modified-since"
 	HeaderIfUnmodifiedSince Header = "if-unmodified-since"
+	HeaderAuthorization     Header = "authorization"
+	HeaderWWWAuthenticate   Header = "www-authenticate"
+	HeaderVary              Header = "vary"
+	HeaderOrigin            Header = "origin"
+	HeaderLocation          Header = "location"
+	HeaderAccept            Header = "accept"
+	HeaderAcceptLanguage    Header = "accept-language"
+	HeaderContentLanguage   Header = "content-language"
+	HeaderContentLocation   Header = "content-location"
+	HeaderUserAgent         Header = "user-agent"
+	HeaderCacheControl      Header = "cache-control"
+	HeaderExpires           Header = "expires"
+	HeaderCookie            Header = "cookie"
+	HeaderSetCookie         Header = "set-cookie"
+	HeaderTrailer           Header = "trailer"
+
+	HeaderDAV         Header = "dav"
+	HeaderDepth       Header = "depth"
+	HeaderDestination Header = "destination"
+	HeaderOverwrite   Header = "overwrite"
+	HeaderIf          Header = "if"
+	HeaderLockToken   Header = "lock-token"
+	HeaderTimeout     Header = "timeout"
+
+	HeaderStrictTransportSecurity Header = "strict-transport-security"
+	HeaderContentSecurityPolicy   Header = "content-security-policy"
+	HeaderXContentTypeOptions     Header = "x-content-type-options"
+	HeaderReferrerPolicy          Header = "referrer-policy"
+	HeaderPermissionsPolicy       Header = "permissions-policy"
+	HeaderXFrameOptions           Header = "x-frame-options"
+
+	HeaderAccessControlAllowOrigin      Header = "access-control-allow-origin"
+	HeaderAccessControlAllowCredentials Header = "access-control-allow-credentials"
+	HeaderAccessControlAllowMethods     Header = "access-control-allow-methods"
+	HeaderAccessControlAllowHeaders     Header = "access-control-allow-headers"
+	HeaderAccessControlExposeHeaders    Header = "access-control-expose-headers"
+	HeaderAccessControlMaxAge           Header = "access-control-max-age"
+	HeaderAccessControlRequestMethod    Header = "access-control-request-method"
+	HeaderAccessControlRequestHeaders   Header = "access-control-request-headers"
 )
 
 const (
@@ -183,8 +231,20 @@ const (
 
 const ExpectHeaderContinue ExpectHeader = "100-continue"
 
+const (
+	AuthSchemeBasic  AuthScheme = "Basic"
+	AuthSchemeDigest AuthScheme = "Digest"
+)
+
+const (
+	SameSiteStrict SameSite = "Strict"
+	SameSiteLax    SameSite = "Lax"
+	SameSiteNone   SameSite = "None"
+)
+
 type Form int
 type Scheme string
+type UriComponent int
 
 const (
 	FormOrigin Form = iota
@@ -193,53 +253,24 @@ const (
 	FormAsterisk
 )
 
+const (
+	UriComponentPath UriComponent = iota
+	UriComponentPathSegment
+	UriComponentQuery
+	UriComponentQueryParam
+	UriComponentUserInfo
+	UriComponentFragment
+)
+
 const (
 	SchemeHttp  Scheme = "http"
 	SchemeHttps Scheme = "https"
 )
 
-func encodePercent(str string) string {
-	encoded := ""
-	for _, char := range str {
-		if (char < 0x21 || char > 0x7E) && char >= 0 && char <= math.MaxUint8 {
-			encoded += "%" + fmt.Sprintf("%02x", char)
-		} else {
-			encoded += string(char)
-		}
-	}
-	return encoded
-}
-
-func decodePercent(str string) string {
-	if len(str) < 3 {
-		return str
-	}
-
-	decoded := ""
-	for index, char := 0, str[0]; index < len(str); index++ {
-		if char == '%' && index < len(str)-2 {
-			if char, err := strconv.ParseInt(str[index+1:index+3], 16, 16); err == nil {
-				decoded += string(char)
-			}
-			index += 2
-		} else {
-			decoded += string(char)
-		}
-		if index < len(str)-1 {
-			char = str[index+1]
-		}
-	}
-	return decoded
-}
-
 func formatTimeGMT(t time.Time) string {
 	return t.UTC().Format(time.RFC1123[:len(time.RFC1123)-3]) + "GMT"
 }
 
-func normalizeCase(str string) string {
-	return strings.ToLower(str)
-}
-
 func isValidHeaderValue(str string) bool {
 	for _, char := range str {
 		if (char < 0x21 || char > 0x7E) && char != ' ' && char != '\t' {
@@ -257,3 +288,29 @@ func isVisibleString(str string) bool {
 	}
 	return true
 }
+
+var headerNameExceptions = map[string]string{
+	"content-md5":      "Content-MD5",
+	"dav":              "DAV",
+	"dnt":              "DNT",
+	"etag":             "ETag",
+	"te":               "TE",
+	"www-authenticate": "WWW-Authenticate",
+	"x-xss-protection": "X-XSS-Protection",
+}
+
+// Returns a header name in its conventional casing, like `Content-Type` or `ETag`.
+func CanonicalHeaderName(name string) string {
+	lower := strings.ToLower(name)
+	if canonical, ok := headerNameExceptions[lower]; ok {
+		return canonical
+	}
+
+	parts := strings.Split(lower, "-")
+	for index, part := range parts {
+		if part != "" {
+			parts[index] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "-")
+}
@@ -8,12 +8,42 @@ import (
 )
 
 func main() {
-	if len(os.Args) != 3 {
-		fmt.Println("usage: " + os.Args[0] + " <static file root> <template root>")
+	if len(os.Args) != 3 && len(os.Args) != 4 {
+		fmt.Println("usage: " + os.Args[0] + " <static file root> <template root> [config file]")
 	} else {
-		fileServer := server.NewFileServer(os.Args[1], os.Args[2])
-		if err := fileServer.Start("0.0.0.0:1440"); err != nil {
+		var config *server.Config
+		if len(os.Args) == 4 {
+			var err error
+			if config, err = server.LoadConfig(os.Args[3]); err != nil {
+				log.Fatalln("An error occurred while loading the config file!")
+			}
+		}
+
+		fileServer, err := server.NewFileServer(os.Args[1], os.Args[2], config)
+		if err != nil {
+			log.Fatalln("An error occurred while configuring the server!")
+		}
+		if err := startListeners(fileServer, config); err != nil {
 			log.Fatalln("An error occurred while starting the server!")
 		}
 	}
 }
+
+func startListeners(fileServer server.Server, config *server.Config) error {
+	listeners := []server.ListenerConfig{{Addr: "0.0.0.0:1440"}}
+	if config != nil && len(config.Listeners) > 0 {
+		listeners = config.Listeners
+	}
+
+	errChan := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener server.ListenerConfig) {
+			if listener.TLS != nil {
+				errChan <- fileServer.StartTLS(listener.Addr, *listener.TLS)
+			} else {
+				errChan <- fileServer.Start(listener.Addr)
+			}
+		}(listener)
+	}
+	return <-errChan
+}
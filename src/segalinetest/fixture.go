@@ -0,0 +1,77 @@
+package segalinetest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A temporary file root and template root for a server under test, which are removed when the test ends.
+type Fixture struct {
+	FileRoot     string
+	TemplateRoot string
+
+	t testing.TB
+}
+
+func NewFixture(t testing.TB) *Fixture {
+	t.Helper()
+	root, err := ioutil.TempDir("", "segaline-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	fixture := &Fixture{
+		FileRoot:     filepath.Join(root, "files"),
+		TemplateRoot: filepath.Join(root, "templates"),
+		t:            t,
+	}
+	fixture.mkdir(fixture.FileRoot)
+	fixture.mkdir(fixture.TemplateRoot)
+	return fixture
+}
+
+// Writes a file below the file root, creating its directories. Paths are given like request paths.
+func (fixture *Fixture) WriteFile(pathString string, content string) *Fixture {
+	fixture.t.Helper()
+	fixture.write(fixture.FileRoot, pathString, content)
+	return fixture
+}
+
+// Writes a template below the template root. Servers keep parsed templates until their watcher reports a change, so
+// templates should be written before the server is created.
+func (fixture *Fixture) WriteTemplate(pathString string, content string) *Fixture {
+	fixture.t.Helper()
+	fixture.write(fixture.TemplateRoot, pathString, content)
+	return fixture
+}
+
+func (fixture *Fixture) Mkdir(pathString string) *Fixture {
+	fixture.t.Helper()
+	fixture.mkdir(filepath.Join(fixture.FileRoot, filepath.FromSlash(pathString)))
+	return fixture
+}
+
+// Reads a file below the file root, for checking what a request stored.
+func (fixture *Fixture) ReadFile(pathString string) (string, bool) {
+	content, err := ioutil.ReadFile(filepath.Join(fixture.FileRoot, filepath.FromSlash(pathString)))
+	return string(content), err == nil
+}
+
+func (fixture *Fixture) write(root string, pathString string, content string) {
+	fixture.t.Helper()
+	filePath := filepath.Join(root, filepath.FromSlash(pathString))
+	fixture.mkdir(filepath.Dir(filePath))
+	if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+		fixture.t.Fatal(err)
+	}
+}
+
+func (fixture *Fixture) mkdir(path string) {
+	fixture.t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		fixture.t.Fatal(err)
+	}
+}
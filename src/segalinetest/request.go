@@ -0,0 +1,74 @@
+package segalinetest
+
+import (
+	"bufio"
+	"bytes"
+	"segaline/src/http"
+)
+
+// Builds a request to send to a server under test. Requests are sent to `localhost` unless another `Host` is set.
+type Request struct {
+	method    http.Method
+	target    string
+	headers   http.Headers
+	body      []byte
+	mediaType http.MediaType
+	chunked   bool
+}
+
+func NewRequest(method http.Method, target string) *Request {
+	return &Request{method: method, target: target}
+}
+
+func Get(target string) *Request {
+	return NewRequest(http.MethodGet, target)
+}
+
+func Head(target string) *Request {
+	return NewRequest(http.MethodHead, target)
+}
+
+// Adds a header field, keeping any fields with the same name so that repeated fields can be tested.
+func (req *Request) WithHeader(header http.Header, value string) *Request {
+	req.headers.Add(header, value)
+	return req
+}
+
+func (req *Request) WithBody(body string, mediaType http.MediaType) *Request {
+	req.body, req.mediaType, req.chunked = []byte(body), mediaType, false
+	return req
+}
+
+// Sends the body in chunks instead of with a `Content-Length`.
+func (req *Request) WithChunkedBody(body string, mediaType http.MediaType) *Request {
+	req.body, req.mediaType, req.chunked = []byte(body), mediaType, true
+	return req
+}
+
+// Returns the request as it will be sent, or nil if the target is not a valid origin-form target.
+func (req *Request) Bytes() []byte {
+	built, err := req.build()
+	if err != nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	_ = built.Write(bufio.NewWriter(&buf))
+	return buf.Bytes()
+}
+
+func (req *Request) build() (http.Request, error) {
+	built, err := http.NewRequest(req.method, "http://localhost"+req.target)
+	if err != nil {
+		return built, err
+	}
+	req.headers.Each(func(name string, value string) {
+		built.Headers.Add(http.Header(name), value)
+	})
+	if req.body != nil {
+		built.WithBody(req.body, req.mediaType)
+		if req.chunked {
+			built.ContentLength = -1
+		}
+	}
+	return built, nil
+}
@@ -0,0 +1,113 @@
+package segalinetest
+
+import (
+	"bufio"
+	"bytes"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strings"
+	"testing"
+)
+
+// A response received by a test, or the error that prevented it from being read. Assertions report failures without
+// stopping the test, and return the result so that they can be chained.
+type Result struct {
+	Response http.Response
+	Err      error
+
+	t        testing.TB
+	reported bool
+}
+
+func (result *Result) Header(header http.Header) string {
+	return result.Response.Headers.Get(header)
+}
+
+func (result *Result) Body() string {
+	return string(result.Response.Body)
+}
+
+func (result *Result) AssertStatus(status http.StatusCode) *Result {
+	result.t.Helper()
+	if result.received() && result.Response.StatusCode != status {
+		result.t.Errorf("expected status %d, got %d", status, result.Response.StatusCode)
+	}
+	return result
+}
+
+func (result *Result) AssertHeader(header http.Header, value string) *Result {
+	result.t.Helper()
+	if !result.received() {
+		return result
+	}
+	if actual, ok := result.Response.Headers.Lookup(header); !ok {
+		result.t.Errorf("expected header %s: %q, got none", header, value)
+	} else if actual != value {
+		result.t.Errorf("expected header %s: %q, got %q", header, value, actual)
+	}
+	return result
+}
+
+func (result *Result) AssertHeaderContains(header http.Header, substr string) *Result {
+	result.t.Helper()
+	if actual := result.Header(header); result.received() && !strings.Contains(actual, substr) {
+		result.t.Errorf("expected header %s to contain %q, got %q", header, substr, actual)
+	}
+	return result
+}
+
+func (result *Result) AssertNoHeader(header http.Header) *Result {
+	result.t.Helper()
+	if actual, ok := result.Response.Headers.Lookup(header); result.received() && ok {
+		result.t.Errorf("expected no header %s, got %q", header, actual)
+	}
+	return result
+}
+
+func (result *Result) AssertBody(body string) *Result {
+	result.t.Helper()
+	if result.received() && result.Body() != body {
+		result.t.Errorf("expected body %q, got %q", body, result.Body())
+	}
+	return result
+}
+
+func (result *Result) AssertBodyContains(substr string) *Result {
+	result.t.Helper()
+	if result.received() && !strings.Contains(result.Body(), substr) {
+		result.t.Errorf("expected body to contain %q, got %q", substr, result.Body())
+	}
+	return result
+}
+
+// Reports a missing response once, so that a chain of assertions does not repeat the same failure.
+func (result *Result) received() bool {
+	result.t.Helper()
+	if result.Err != nil && !result.reported {
+		result.t.Errorf("no response: %v", result.Err)
+		result.reported = true
+	}
+	return result.Err == nil
+}
+
+// Records what is written to a response writer, for testing code that responds without a connection.
+type Recorder struct {
+	Writer *bufio.Writer
+
+	buf bytes.Buffer
+	t   testing.TB
+}
+
+func NewRecorder(t testing.TB) *Recorder {
+	recorder := &Recorder{t: t}
+	recorder.Writer = bufio.NewWriter(&recorder.buf)
+	return recorder
+}
+
+// Parses the recorded response to a request with a method, which decides whether the response has a body.
+func (recorder *Recorder) Result(method http.Method) *Result {
+	_ = recorder.Writer.Flush()
+	reader := bufio.NewReader(bytes.NewReader(recorder.buf.Bytes()))
+	res, err := http.ParseResponse(nil, reader, &http.Request{Method: method}, util.ClientDefaultMaxBodySize)
+	return &Result{Response: res, Err: err, t: recorder.t}
+}
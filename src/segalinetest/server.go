@@ -0,0 +1,139 @@
+package segalinetest
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"segaline/src/http"
+	"segaline/src/server"
+	"segaline/src/util"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Runs a FileServer for a test, which is stopped when the test ends. Each request is sent on a new connection, over
+// an in-memory pipe unless the server listens on loopback.
+type Server struct {
+	// The base URL of a listening server, like `http://127.0.0.1:52731`, which is empty for in-memory servers.
+	URL string
+
+	server   server.Server
+	listener net.Listener
+	t        testing.TB
+}
+
+// Without a config, the server reads files straight from disk, so that changes to the fixture are seen at once and no
+// watcher has to be started.
+func NewServer(t testing.TB, fixture *Fixture, config *server.Config) *Server {
+	t.Helper()
+	if config == nil {
+		config = &server.Config{FileCache: server.FileCacheConfig{Disabled: true}}
+	}
+	fileServer, err := server.NewFileServer(fixture.FileRoot, fixture.TemplateRoot, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fileServer.Stop() })
+	return &Server{server: fileServer, t: t}
+}
+
+// Creates a server that listens on an ephemeral loopback port, for tests that need a real network connection, such
+// as those using a client.
+func NewListeningServer(t testing.TB, fixture *Fixture, config *server.Config) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testServer := NewServer(t, fixture, config)
+	testServer.listener = listener
+	testServer.URL = "http://" + listener.Addr().String()
+	go func() { _ = testServer.server.Serve(listener) }()
+	return testServer
+}
+
+// Sends a request and reads its response, giving up if it does not arrive in time.
+func (testServer *Server) Do(req *Request) *Result {
+	testServer.t.Helper()
+	return testServer.DoAll(req)[0]
+}
+
+// Sends requests one after another on the same connection without waiting for their responses, and reads a result
+// for each of them. Results after a failed one have the same error.
+func (testServer *Server) DoAll(reqs ...*Request) []*Result {
+	testServer.t.Helper()
+	methods := make([]http.Method, len(reqs))
+	built := make([]http.Request, len(reqs))
+	for index, req := range reqs {
+		methods[index] = req.method
+		var err error
+		if built[index], err = req.build(); err != nil {
+			return testServer.failAll(len(reqs), err)
+		}
+	}
+	return testServer.exchange(methods, func(writer *bufio.Writer) error {
+		for index := range built {
+			if err := built[index].Write(writer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Sends raw bytes as they are, for requests the builder cannot create, such as malformed ones.
+func (testServer *Server) DoRaw(raw string) *Result {
+	testServer.t.Helper()
+	method := http.Method(strings.SplitN(raw, " ", 2)[0])
+	return testServer.exchange([]http.Method{method}, func(writer *bufio.Writer) error {
+		if _, err := writer.WriteString(raw); err != nil {
+			return err
+		}
+		return writer.Flush()
+	})[0]
+}
+
+func (testServer *Server) exchange(methods []http.Method, write func(writer *bufio.Writer) error) []*Result {
+	testServer.t.Helper()
+	conn, err := testServer.dial()
+	if err != nil {
+		return testServer.failAll(len(methods), err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(util.TestResponseTimeout))
+
+	// Pipes are unbuffered, so requests are written while responses are read.
+	go func() { _ = write(bufio.NewWriter(conn)) }()
+
+	results := make([]*Result, len(methods))
+	reader := bufio.NewReader(conn)
+	for index, method := range methods {
+		var res http.Response
+		if err == nil {
+			res, err = http.ParseResponse(conn, reader, &http.Request{Method: method}, util.ClientDefaultMaxBodySize)
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				err = errors.New(util.ErrorTimeoutReached)
+			}
+		}
+		results[index] = &Result{Response: res, Err: err, t: testServer.t}
+	}
+	return results
+}
+
+func (testServer *Server) failAll(count int, err error) []*Result {
+	results := make([]*Result, count)
+	for index := range results {
+		results[index] = &Result{Err: err, t: testServer.t}
+	}
+	return results
+}
+
+func (testServer *Server) dial() (net.Conn, error) {
+	if testServer.listener != nil {
+		return net.Dial("tcp", testServer.listener.Addr().String())
+	}
+	client, serverConn := net.Pipe()
+	go testServer.server.ServeConn(serverConn)
+	return client, nil
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type authRealm struct {
+	pathPrefix string
+	name       string
+	scheme     http.AuthScheme
+
+	// For Basic realms, this maps users to htpasswd hashes; for Digest realms, to hex encoded SHA-256 HA1 values.
+	users map[string]string
+
+	nonceKey      []byte
+	nonceLifetime time.Duration
+	nonceCounts   map[string]uint64
+	nonceLock     sync.Mutex
+	lastPrune     time.Time
+}
+
+func newAuthRealm(config AuthConfig) (*authRealm, error) {
+	realm := &authRealm{
+		pathPrefix:    strings.TrimSuffix(config.PathPrefix, "/"),
+		name:          config.Realm,
+		nonceLifetime: util.DefaultDigestNonceLifetime,
+		nonceCounts:   map[string]uint64{},
+	}
+	if config.NonceLifetime > 0 {
+		realm.nonceLifetime = time.Duration(config.NonceLifetime) * time.Second
+	}
+
+	switch strings.ToLower(config.Scheme) {
+	case "basic":
+		realm.scheme = http.AuthSchemeBasic
+	case "digest":
+		realm.scheme = http.AuthSchemeDigest
+		realm.nonceKey = make([]byte, 32)
+		if _, err := rand.Read(realm.nonceKey); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported authentication scheme: " + config.Scheme)
+	}
+
+	users, err := realm.readUserFile(config.UserFile)
+	if err != nil {
+		return nil, err
+	}
+	realm.users = users
+	return realm, nil
+}
+
+// Basic realms read htpasswd files (`user:hash`), and Digest realms read htdigest style files (`user:realm:ha1`),
+// where lines for other realms are skipped.
+func (realm *authRealm) readUserFile(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	users := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if realm.scheme == http.AuthSchemeBasic {
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) < 2 {
+				return nil, errors.New("invalid htpasswd line")
+			}
+			users[parts[0]] = parts[1]
+		} else {
+			parts := strings.SplitN(line, ":", 3)
+			if len(parts) < 3 {
+				return nil, errors.New("invalid htdigest line")
+			}
+			if parts[1] == realm.name {
+				users[parts[0]] = strings.ToLower(parts[2])
+			}
+		}
+	}
+	return users, nil
+}
+
+func (realm *authRealm) challenge(stale bool) string {
+	if realm.scheme == http.AuthSchemeBasic {
+		return fmt.Sprintf("%s realm=%s, charset=\"UTF-8\"", realm.scheme, quoteString(realm.name))
+	}
+
+	challenge := fmt.Sprintf(
+		"%s realm=%s, qop=\"auth\", algorithm=SHA-256, nonce=\"%s\"",
+		realm.scheme,
+		quoteString(realm.name),
+		realm.newNonce(),
+	)
+	if stale {
+		challenge += ", stale=true"
+	}
+	return challenge
+}
+
+// Returns the authenticated user, or whether the credentials were valid but used an expired nonce.
+func (realm *authRealm) authenticate(req *http.Request) (user string, stale bool, ok bool) {
+	authorization, present := req.Headers.Lookup(http.HeaderAuthorization)
+	if !present {
+		return
+	}
+
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) < 2 || !strings.EqualFold(parts[0], string(realm.scheme)) {
+		return
+	}
+
+	credentials := strings.Trim(parts[1], util.RequestOWS)
+	if realm.scheme == http.AuthSchemeBasic {
+		user, ok = realm.authenticateBasic(credentials)
+	} else {
+		user, stale, ok = realm.authenticateDigest(req, credentials)
+	}
+	return
+}
+
+func (realm *authRealm) authenticateBasic(credentials string) (string, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return "", false
+	}
+
+	userAndPassword := strings.SplitN(string(decoded), ":", 2)
+	if len(userAndPassword) < 2 {
+		return "", false
+	}
+	user, password := userAndPassword[0], userAndPassword[1]
+
+	hash, ok := realm.users[user]
+	return user, ok && checkPasswordHash(hash, password)
+}
+
+func (realm *authRealm) authenticateDigest(req *http.Request, credentials string) (string, bool, bool) {
+	params, err := parseAuthParams(credentials)
+	if err != nil {
+		return "", false, false
+	}
+
+	user := params["username"]
+	ha1, ok := realm.users[user]
+	if !ok || params["realm"] != realm.name || params["qop"] != "auth" || params["algorithm"] != "SHA-256" {
+		return "", false, false
+	}
+
+	uri, err := http.ParseUri(req.Method, params["uri"])
+	if err != nil || uri.PathString() != req.OriginalUri.PathString() {
+		return "", false, false
+	}
+
+	nonce, nonceCount, cnonce := params["nonce"], params["nc"], params["cnonce"]
+	ha2 := sha256Hex(string(req.Method) + ":" + params["uri"])
+	expected := sha256Hex(strings.Join([]string{ha1, nonce, nonceCount, cnonce, "auth", ha2}, ":"))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+		return "", false, false
+	}
+
+	count, err := strconv.ParseUint(nonceCount, 16, 64)
+	if err != nil {
+		return "", false, false
+	}
+	valid, expired := realm.checkNonce(nonce, count)
+	return user, expired, valid
+}
+
+// Nonces are stateless (a timestamp signed with a per-realm key), but the last seen nonce count for each live nonce
+// is remembered to reject replayed requests.
+func (realm *authRealm) newNonce() string {
+	timestamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestamp, uint64(time.Now().UnixNano()))
+	return base64.RawURLEncoding.EncodeToString(append(timestamp, realm.signNonce(timestamp)...))
+}
+
+func (realm *authRealm) signNonce(timestamp []byte) []byte {
+	mac := hmac.New(sha256.New, realm.nonceKey)
+	mac.Write(timestamp)
+	return mac.Sum(nil)[:16]
+}
+
+func (realm *authRealm) checkNonce(nonce string, count uint64) (valid bool, expired bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(raw) != 24 || !hmac.Equal(raw[8:], realm.signNonce(raw[:8])) {
+		return
+	}
+
+	issued := time.Unix(0, int64(binary.BigEndian.Uint64(raw[:8])))
+	if time.Since(issued) > realm.nonceLifetime {
+		return false, true
+	}
+
+	realm.nonceLock.Lock()
+	defer realm.nonceLock.Unlock()
+
+	if count <= realm.nonceCounts[nonce] {
+		return
+	}
+	realm.nonceCounts[nonce] = count
+	realm.pruneNonceCounts()
+	return true, false
+}
+
+// Forgets the counts of expired nonces. Nonces only expire once their lifetime has passed, so scanning more often
+// than that would find little to remove.
+func (realm *authRealm) pruneNonceCounts() {
+	if time.Since(realm.lastPrune) < realm.nonceLifetime {
+		return
+	}
+	realm.lastPrune = time.Now()
+
+	for nonce := range realm.nonceCounts {
+		raw, _ := base64.RawURLEncoding.DecodeString(nonce)
+		if time.Since(time.Unix(0, int64(binary.BigEndian.Uint64(raw[:8])))) > realm.nonceLifetime {
+			delete(realm.nonceCounts, nonce)
+		}
+	}
+}
+
+func (server *FileServer) authRealmFor(path string) *authRealm {
+	var match *authRealm
+	for _, realm := range server.authRealms {
+		if hasPathPrefix(path, realm.pathPrefix) && (match == nil || len(realm.pathPrefix) > len(match.pathPrefix)) {
+			match = realm
+		}
+	}
+	return match
+}
+
+func (server *FileServer) authenticate(req *http.Request, writer *bufio.Writer) bool {
+	if req.Uri.Form() == http.FormAsterisk {
+		return true
+	}
+	realm := server.authRealmFor(req.Uri.PathString())
+	if realm == nil {
+		return true
+	}
+
+	user, stale, ok := realm.authenticate(req)
+	if ok {
+		req.RemoteUser = user
+		return true
+	}
+
+	server.newErrorResponse(req, http.StatusUnauthorized, false).
+		WithHeader(http.HeaderWWWAuthenticate, realm.challenge(stale)).
+		Respond(writer)
+	return false
+}
+
+func checkPasswordHash(hash string, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash[5:])) == 1
+	}
+	return false
+}
+
+func sha256Hex(str string) string {
+	sum := sha256.Sum256([]byte(str))
+	return hex.EncodeToString(sum[:])
+}
+
+// Parses a comma separated list of `name=value` or `name="quoted value"` pairs, as used in Digest credentials.
+func parseAuthParams(str string) (map[string]string, error) {
+	params := map[string]string{}
+
+	for str = strings.Trim(str, util.RequestOWS); str != ""; str = strings.TrimLeft(str, util.RequestOWS+",") {
+		equals := strings.Index(str, "=")
+		if equals < 1 {
+			return nil, errors.New("invalid auth param")
+		}
+		name := strings.ToLower(strings.Trim(str[:equals], util.RequestOWS))
+		str = strings.TrimLeft(str[equals+1:], util.RequestOWS)
+
+		var value string
+		if strings.HasPrefix(str, "\"") {
+			var builder strings.Builder
+			index := 1
+			for ; index < len(str) && str[index] != '"'; index++ {
+				if str[index] == '\\' && index+1 < len(str) {
+					index++
+				}
+				builder.WriteByte(str[index])
+			}
+			if index >= len(str) {
+				return nil, errors.New("unterminated quoted string")
+			}
+			value, str = builder.String(), str[index+1:]
+		} else {
+			end := strings.Index(str, ",")
+			if end < 0 {
+				end = len(str)
+			}
+			value, str = strings.Trim(str[:end], util.RequestOWS), str[end:]
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+func quoteString(str string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(str) + "\""
+}
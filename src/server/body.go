@@ -0,0 +1,49 @@
+package server
+
+import (
+	"bufio"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strings"
+)
+
+type bodyLimit struct {
+	pathPrefix string
+	maxSize    int64
+}
+
+func newBodyLimit(config BodyLimitConfig) bodyLimit {
+	return bodyLimit{pathPrefix: strings.TrimSuffix(config.PathPrefix, "/"), maxSize: config.MaxSize}
+}
+
+// Returns the body size limit with the longest path prefix matching a request, or the default limit if none
+// matches. Upload directories allow bodies up to their file or total size quota.
+func (server *FileServer) bodyLimitFor(req *http.Request) int64 {
+	pathString := req.Uri.PathString()
+	limit, matchLength := int64(util.RequestMaxContentLength), -1
+	for _, policy := range server.bodyLimits {
+		if hasPathPrefix(pathString, policy.pathPrefix) && len(policy.pathPrefix) > matchLength {
+			limit, matchLength = policy.maxSize, len(policy.pathPrefix)
+		}
+	}
+
+	if upload := server.uploadPolicyFor(pathString); upload != nil && len(upload.pathPrefix) > matchLength {
+		switch req.Method {
+		case http.MethodPut:
+			limit = upload.maxFileSize
+		case http.MethodPost:
+			limit = upload.maxTotalSize
+		}
+	}
+	return limit
+}
+
+// Responds with 413 if the request declares a body larger than its route allows. Bodies of unknown length are
+// limited as they are read instead. The connection is closed, since the body will not be read.
+func (server *FileServer) checkBodyLimit(req *http.Request, writer *bufio.Writer) bool {
+	if err := req.LimitBody(server.bodyLimitFor(req)); err != nil {
+		server.respondErrorTemplate(writer, req, http.StatusEntityTooLarge, true)
+		return false
+	}
+	return true
+}
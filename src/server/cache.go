@@ -0,0 +1,118 @@
+package server
+
+import (
+	"path"
+	"regexp"
+	"segaline/src/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type cachePolicy struct {
+	pathGlob   *regexp.Regexp
+	extensions []string
+	mediaTypes []string
+
+	cacheControl string
+	maxAge       int
+}
+
+func newCachePolicy(config CachePolicyConfig) *cachePolicy {
+	policy := &cachePolicy{mediaTypes: config.MediaTypes, maxAge: -1}
+	if config.PathGlob != "" {
+		policy.pathGlob = compilePathGlob(config.PathGlob)
+	}
+	for _, ext := range config.Extensions {
+		policy.extensions = append(policy.extensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+
+	var directives []string
+	switch {
+	case config.Private:
+		directives = append(directives, "private")
+	case config.Public:
+		directives = append(directives, "public")
+	}
+	if config.NoStore {
+		directives = append(directives, "no-store")
+	}
+	if config.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	if config.MaxAge != nil {
+		policy.maxAge = *config.MaxAge
+		directives = append(directives, "max-age="+strconv.Itoa(*config.MaxAge))
+	}
+	if config.SMaxAge != nil {
+		directives = append(directives, "s-maxage="+strconv.Itoa(*config.SMaxAge))
+	}
+	if config.StaleWhileRevalidate != nil {
+		directives = append(directives, "stale-while-revalidate="+strconv.Itoa(*config.StaleWhileRevalidate))
+	}
+	if config.Immutable {
+		directives = append(directives, "immutable")
+	}
+	policy.cacheControl = strings.Join(directives, ", ")
+	return policy
+}
+
+// A policy matches if every selector it has (path glob, extensions and media types) matches.
+func (policy *cachePolicy) matches(pathString string, mediaType http.MediaType) bool {
+	if policy.pathGlob != nil && !policy.pathGlob.MatchString(pathString) {
+		return false
+	}
+
+	if len(policy.extensions) > 0 {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(pathString), "."))
+		matched := false
+		for _, policyExt := range policy.extensions {
+			matched = matched || policyExt == ext
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return len(policy.mediaTypes) == 0 || matchesMediaType(policy.mediaTypes, mediaType)
+}
+
+// Adds the `Cache-Control` and `Expires` headers of the first matching cache policy to a response, and reports whether
+// a policy matched.
+func (server *FileServer) applyCachePolicy(res *http.Response, pathString string, mediaType http.MediaType) bool {
+	for _, policy := range server.cachePolicies {
+		if !policy.matches(pathString, mediaType) {
+			continue
+		}
+
+		if policy.cacheControl != "" {
+			res.WithHeader(http.HeaderCacheControl, policy.cacheControl)
+		}
+		if policy.maxAge >= 0 {
+			res.WithHeader(http.HeaderExpires, formatTimeGMT(time.Now().Add(time.Duration(policy.maxAge)*time.Second)))
+		}
+		return true
+	}
+	return false
+}
+
+// Compiles a glob where `*` and `?` match within a path segment and `**` matches across segments.
+func compilePathGlob(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for index := 0; index < len(glob); index++ {
+		switch {
+		case strings.HasPrefix(glob[index:], "**"):
+			pattern.WriteString(".*")
+			index++
+		case glob[index] == '*':
+			pattern.WriteString("[^/]*")
+		case glob[index] == '?':
+			pattern.WriteString("[^/]")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(glob[index : index+1]))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+type Config struct {
+	Listeners       []ListenerConfig   `json:"listeners"`
+	Sites           []SiteConfig       `json:"sites"`
+	Auth            []AuthConfig       `json:"auth"`
+	ClientCertRules []ClientCertConfig `json:"clientCertRules"`
+	CORS            []CORSConfig       `json:"cors"`
+
+	SecurityHeaders []SecurityHeadersConfig `json:"securityHeaders"`
+	RewriteRules    []RewriteRuleConfig     `json:"rewriteRules"`
+	RewriteRuleFile string                  `json:"rewriteRuleFile"`
+	SPA             []SPAConfig             `json:"spa"`
+	CachePolicies   []CachePolicyConfig     `json:"cachePolicies"`
+	FileCache       FileCacheConfig         `json:"fileCache"`
+	LiveReload      bool                    `json:"liveReload"`
+	BodyLimits      []BodyLimitConfig       `json:"bodyLimits"`
+	Uploads         []UploadConfig          `json:"uploads"`
+	WebDAV          []WebDAVConfig          `json:"webDAV"`
+	Negotiation     []NegotiationConfig     `json:"negotiation"`
+}
+
+type ListenerConfig struct {
+	Addr string     `json:"addr"`
+	TLS  *TLSConfig `json:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile     string `json:"certFile"`
+	KeyFile      string `json:"keyFile"`
+	ClientCAFile string `json:"clientCAFile"`
+	ClientAuth   string `json:"clientAuth"`
+}
+
+type SiteConfig struct {
+	Hosts          []string          `json:"hosts"`
+	FileRoot       string            `json:"fileRoot"`
+	TemplateRoot   string            `json:"templateRoot"`
+	IndexDocuments []string          `json:"indexDocuments"`
+	ErrorPages     map[string]string `json:"errorPages"`
+	Default        bool              `json:"default"`
+}
+
+type AuthConfig struct {
+	PathPrefix    string `json:"pathPrefix"`
+	Realm         string `json:"realm"`
+	Scheme        string `json:"scheme"`
+	UserFile      string `json:"userFile"`
+	NonceLifetime int    `json:"nonceLifetime"`
+}
+
+type ClientCertConfig struct {
+	PathPrefix string   `json:"pathPrefix"`
+	Subjects   []string `json:"subjects"`
+	SANs       []string `json:"sans"`
+}
+
+type CORSConfig struct {
+	PathPrefix       string   `json:"pathPrefix"`
+	AllowedOrigins   []string `json:"allowedOrigins"`
+	AllowedMethods   []string `json:"allowedMethods"`
+	AllowedHeaders   []string `json:"allowedHeaders"`
+	ExposedHeaders   []string `json:"exposedHeaders"`
+	AllowCredentials bool     `json:"allowCredentials"`
+	MaxAge           int      `json:"maxAge"`
+}
+
+type SecurityHeadersConfig struct {
+	PathPrefix string   `json:"pathPrefix"`
+	Extensions []string `json:"extensions"`
+
+	StrictTransportSecurity string `json:"strictTransportSecurity"`
+	ContentSecurityPolicy   string `json:"contentSecurityPolicy"`
+	ContentTypeOptions      string `json:"contentTypeOptions"`
+	ReferrerPolicy          string `json:"referrerPolicy"`
+	PermissionsPolicy       string `json:"permissionsPolicy"`
+	FrameOptions            string `json:"frameOptions"`
+	Server                  string `json:"server"`
+}
+
+type RewriteRuleConfig struct {
+	Path    string            `json:"path"`
+	Host    string            `json:"host"`
+	Query   map[string]string `json:"query"`
+	Headers map[string]string `json:"headers"`
+
+	Rewrite  string `json:"rewrite"`
+	Redirect string `json:"redirect"`
+	Status   int    `json:"status"`
+}
+
+type SPAConfig struct {
+	PathPrefix   string `json:"pathPrefix"`
+	Fallback     string `json:"fallback"`
+	CacheControl string `json:"cacheControl"`
+}
+
+type CachePolicyConfig struct {
+	PathGlob   string   `json:"pathGlob"`
+	Extensions []string `json:"extensions"`
+	MediaTypes []string `json:"mediaTypes"`
+
+	MaxAge               *int `json:"maxAge"`
+	SMaxAge              *int `json:"sMaxAge"`
+	StaleWhileRevalidate *int `json:"staleWhileRevalidate"`
+	Immutable            bool `json:"immutable"`
+	NoCache              bool `json:"noCache"`
+	NoStore              bool `json:"noStore"`
+	Private              bool `json:"private"`
+	Public               bool `json:"public"`
+}
+
+type FileCacheConfig struct {
+	MemoryBudget int64 `json:"memoryBudget"`
+	MaxFileSize  int64 `json:"maxFileSize"`
+	Disabled     bool  `json:"disabled"`
+}
+
+type BodyLimitConfig struct {
+	PathPrefix string `json:"pathPrefix"`
+	MaxSize    int64  `json:"maxSize"`
+}
+
+type UploadConfig struct {
+	PathPrefix   string   `json:"pathPrefix"`
+	MaxFileSize  int64    `json:"maxFileSize"`
+	MaxTotalSize int64    `json:"maxTotalSize"`
+	AllowedTypes []string `json:"allowedTypes"`
+}
+
+type WebDAVConfig struct {
+	PathPrefix     string `json:"pathPrefix"`
+	MaxFileSize    int64  `json:"maxFileSize"`
+	MaxLockTimeout int    `json:"maxLockTimeout"`
+}
+
+type NegotiationConfig struct {
+	PathPrefix      string `json:"pathPrefix"`
+	DefaultLanguage string `json:"defaultLanguage"`
+	Strict          bool   `json:"strict"`
+	MultipleChoices bool   `json:"multipleChoices"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
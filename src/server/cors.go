@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"regexp"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+)
+
+type corsPolicy struct {
+	pathPrefix string
+
+	anyOrigin      bool
+	origins        []*regexp.Regexp
+	methods        []string
+	anyHeader      bool
+	headers        []string
+	exposedHeaders []string
+
+	allowCredentials bool
+	maxAge           int
+}
+
+// Allowed origins are either `*`, exact origins, wildcard patterns like `https://*.example.com`, or regular
+// expressions prefixed with `~`.
+func newCORSPolicy(config CORSConfig) (*corsPolicy, error) {
+	policy := &corsPolicy{
+		pathPrefix:       strings.TrimSuffix(config.PathPrefix, "/"),
+		exposedHeaders:   config.ExposedHeaders,
+		allowCredentials: config.AllowCredentials,
+		maxAge:           config.MaxAge,
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		var pattern string
+		switch {
+		case origin == "*":
+			policy.anyOrigin = true
+			continue
+		case strings.HasPrefix(origin, "~"):
+			// Regular expressions must match the whole origin, or `example\.com` would also allow `example.com.evil.net`.
+			pattern = "^(?:" + origin[1:] + ")$"
+		default:
+			pattern = "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(origin)), `\*`, `[^/]*`) + "$"
+		}
+
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New("invalid cors origin pattern: " + origin)
+		}
+		policy.origins = append(policy.origins, regex)
+	}
+
+	policy.methods = config.AllowedMethods
+	if len(policy.methods) == 0 {
+		policy.methods = []string{string(http.MethodGet), string(http.MethodHead)}
+	}
+	for _, header := range config.AllowedHeaders {
+		if header == "*" {
+			policy.anyHeader = true
+		} else {
+			policy.headers = append(policy.headers, strings.ToLower(header))
+		}
+	}
+	return policy, nil
+}
+
+func (policy *corsPolicy) allowsOrigin(origin string) bool {
+	if policy.anyOrigin {
+		return true
+	}
+	for _, regex := range policy.origins {
+		if regex.MatchString(strings.ToLower(origin)) || regex.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *corsPolicy) allowsMethod(method string) bool {
+	for _, allowed := range policy.methods {
+		if allowed == method || allowed == "*" && !policy.allowCredentials {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *corsPolicy) allowsHeaders(headers []string) bool {
+	if policy.anyHeader && !policy.allowCredentials {
+		return true
+	}
+
+outer:
+	for _, header := range headers {
+		for _, allowed := range policy.headers {
+			if allowed == header {
+				continue outer
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// With credentials, the wildcard cannot be used, so the request origin is reflected instead.
+func (policy *corsPolicy) allowOriginValue(origin string) string {
+	if policy.anyOrigin && !policy.allowCredentials {
+		return "*"
+	}
+	return origin
+}
+
+// The response varies by origin unless every origin gets the same literal `*`.
+func (policy *corsPolicy) variesByOrigin() bool {
+	return !policy.anyOrigin || policy.allowCredentials
+}
+
+func (server *FileServer) corsPolicyFor(path string) *corsPolicy {
+	var match *corsPolicy
+	for _, policy := range server.corsPolicies {
+		if hasPathPrefix(path, policy.pathPrefix) && (match == nil || len(policy.pathPrefix) > len(match.pathPrefix)) {
+			match = policy
+		}
+	}
+	return match
+}
+
+func isCORSPreflight(req *http.Request) bool {
+	hasOrigin := req.Headers.Has(http.HeaderOrigin)
+	hasMethod := req.Headers.Has(http.HeaderAccessControlRequestMethod)
+	return req.Method == http.MethodOptions && hasOrigin && hasMethod
+}
+
+// Answers a CORS preflight request. A rejected preflight is answered without any access control headers, which
+// the browser treats as a failure.
+func (server *FileServer) handleCORSPreflight(req *http.Request, writer *bufio.Writer) bool {
+	res := server.newResponse(req).WithStatus(http.StatusNoContent)
+	policy := server.corsPolicyFor(req.Uri.PathString())
+	if policy == nil {
+		res.Respond(writer)
+		return req.WillCloseConnection()
+	}
+
+	origin := req.Headers.Get(http.HeaderOrigin)
+	method := req.Headers.Get(http.HeaderAccessControlRequestMethod)
+	var requestHeaders []string
+	for _, header := range strings.Split(req.Headers.Get(http.HeaderAccessControlRequestHeaders), ",") {
+		if header = strings.ToLower(strings.Trim(header, util.RequestOWS)); header != "" {
+			requestHeaders = append(requestHeaders, header)
+		}
+	}
+
+	addVary(res, string(http.HeaderAccessControlRequestMethod))
+	addVary(res, string(http.HeaderAccessControlRequestHeaders))
+	if !policy.allowsOrigin(origin) || !policy.allowsMethod(method) || !policy.allowsHeaders(requestHeaders) {
+		res.WithoutHeader(http.HeaderAccessControlAllowOrigin).WithoutHeader(http.HeaderAccessControlAllowCredentials)
+		res.Respond(writer)
+		return req.WillCloseConnection()
+	}
+
+	res.WithHeader(http.HeaderAccessControlAllowMethods, method)
+	if len(requestHeaders) > 0 {
+		res.WithHeader(http.HeaderAccessControlAllowHeaders, strings.Join(requestHeaders, ", "))
+	}
+	if policy.maxAge > 0 {
+		res.WithHeader(http.HeaderAccessControlMaxAge, strconv.Itoa(policy.maxAge))
+	}
+	res.Respond(writer)
+	return req.WillCloseConnection()
+}
+
+// Adds the access control headers common to preflight and actual cross-origin responses.
+func (server *FileServer) applyCORSHeaders(req *http.Request, res *http.Response) {
+	policy := server.corsPolicyFor(req.Uri.PathString())
+	if policy == nil {
+		return
+	}
+	if policy.variesByOrigin() {
+		addVary(res, string(http.HeaderOrigin))
+	}
+
+	origin, ok := req.Headers.Lookup(http.HeaderOrigin)
+	if !ok || !policy.allowsOrigin(origin) {
+		return
+	}
+
+	res.WithHeader(http.HeaderAccessControlAllowOrigin, policy.allowOriginValue(origin))
+	if policy.allowCredentials {
+		res.WithHeader(http.HeaderAccessControlAllowCredentials, "true")
+	}
+	if len(policy.exposedHeaders) > 0 && !isCORSPreflight(req) {
+		res.WithHeader(http.HeaderAccessControlExposeHeaders, strings.Join(policy.exposedHeaders, ", "))
+	}
+}
+
+func addVary(res *http.Response, header string) {
+	if vary := res.Headers.Get(http.HeaderVary); vary != "" {
+		for _, existing := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.Trim(existing, util.RequestOWS), header) {
+				return
+			}
+		}
+		res.WithHeader(http.HeaderVary, vary+", "+header)
+	} else {
+		res.WithHeader(http.HeaderVary, header)
+	}
+}
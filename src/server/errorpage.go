@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type errorPageData struct {
+	StatusCode   int
+	ReasonPhrase string
+	Path         string
+	Method       string
+	RequestID    string
+	Timestamp    string
+	ServerInfo   string
+}
+
+type templateEntry struct {
+	template *template.Template
+	err      error
+}
+
+// Templates are parsed once and kept in memory until the watcher reports a change, or for as long as the server runs
+// if there is no watcher. Missing templates are remembered as well, so fallback chains do not hit the disk each time.
+type templateStore struct {
+	entries map[string]templateEntry
+	lock    sync.RWMutex
+}
+
+func newTemplateStore() *templateStore {
+	return &templateStore{entries: map[string]templateEntry{}}
+}
+
+func (store *templateStore) get(path string) (*template.Template, error) {
+	path = filepath.Clean(path)
+
+	store.lock.RLock()
+	entry, ok := store.entries[path]
+	store.lock.RUnlock()
+	if ok {
+		return entry.template, entry.err
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err == nil {
+		entry.template, err = parseErrorTemplate(filepath.Base(path), string(content))
+	}
+	entry.err = err
+
+	store.lock.Lock()
+	store.entries[path] = entry
+	store.lock.Unlock()
+	return entry.template, entry.err
+}
+
+func (store *templateStore) invalidate(path string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.entries, filepath.Clean(path))
+}
+
+func (store *templateStore) invalidateAll() {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.entries = map[string]templateEntry{}
+}
+
+// The `{statusCode}` and `{serverInfo}` placeholders of older templates are still supported.
+func parseErrorTemplate(name string, content string) (*template.Template, error) {
+	content = strings.NewReplacer("{statusCode}", "{{.StatusCode}}", "{serverInfo}", "{{.ServerInfo}}").Replace(content)
+	return template.New(name).Parse(content)
+}
+
+var fallbackErrorTemplate = template.Must(parseErrorTemplate("fallback", util.DefaultFallbackErrorTemplate))
+
+func (server *FileServer) newErrorResponse(req *http.Request, status http.StatusCode, close bool) *http.Response {
+	res := server.newResponse(req).WithStatus(status)
+	if close {
+		res.WithHeader(http.HeaderConnection, string(http.ConnectionHeaderClose))
+	}
+	if status == http.StatusMethodNotAllowed {
+		res.WithHeader(http.HeaderAllow, formatMethods(server.allowedMethods(req)))
+	}
+
+	data := errorPageData{
+		StatusCode:   int(status),
+		ReasonPhrase: http.ReasonPhrase(status),
+		Path:         req.Uri.PathString(),
+		Method:       string(req.Method),
+		RequestID:    req.ID,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		ServerInfo:   util.ServerNameVersion,
+	}
+
+	addVary(res, string(http.HeaderAccept))
+	if prefersJSON(req) {
+		content, _ := json.Marshal(map[string]interface{}{
+			"status":    data.StatusCode,
+			"reason":    data.ReasonPhrase,
+			"path":      data.Path,
+			"method":    data.Method,
+			"requestId": data.RequestID,
+			"timestamp": data.Timestamp,
+		})
+		return res.WithBody(content, http.MediaTypeJSON)
+	}
+
+	var content bytes.Buffer
+	if err := server.errorTemplateFor(req, status).Execute(&content, data); err != nil {
+		content.Reset()
+		_ = fallbackErrorTemplate.Execute(&content, data)
+	}
+	return res.WithBody(content.Bytes(), http.MediaTypeHTML)
+}
+
+// Finds the most specific error template for a status code: a page configured for the site, then `404.html`, then
+// `4xx.html`, then `error.html`, and finally a built in fallback.
+func (server *FileServer) errorTemplateFor(req *http.Request, status http.StatusCode) *template.Template {
+	site, _ := server.siteFor(req)
+	code := strconv.Itoa(int(status))
+
+	var names []string
+	if page, ok := site.errorPages[status]; ok {
+		names = append(names, strings.TrimPrefix(page, "/"))
+	}
+	names = append(names, code+".html", code[:1]+"xx.html", "error.html")
+
+	for _, name := range names {
+		if tmpl, err := server.templates.get(site.templateRoot + "/" + name); err == nil {
+			return tmpl
+		}
+	}
+	return fallbackErrorTemplate
+}
+
+// Error bodies are JSON only if the client ranks JSON strictly above HTML.
+func prefersJSON(req *http.Request) bool {
+	accept, ok := req.Headers.Lookup(http.HeaderAccept)
+	if !ok {
+		return false
+	}
+	return mediaTypeQuality(accept, http.MediaTypeJSON) > mediaTypeQuality(accept, http.MediaTypeHTML)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type cachedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	eTag    string
+
+	// This is nil for files larger than the per-file size cap, whose metadata is cached but whose content is not.
+	content []byte
+}
+
+// A bounded LRU cache of file metadata, ETags and (for small enough files) content, keyed by path. Cached content is
+// validated by a hash of it, and larger files by their modification time and size. Entries
+// are revalidated against the file's modification time and size on every lookup, and can also be invalidated
+// explicitly when a change is known to have happened.
+type fileCache struct {
+	entries map[string]*list.Element
+	order   *list.List
+	used    int64
+
+	memoryBudget int64
+	maxFileSize  int64
+	disabled     bool
+	lock         sync.Mutex
+}
+
+func newFileCache(memoryBudget int64, maxFileSize int64) *fileCache {
+	return &fileCache{
+		entries:      map[string]*list.Element{},
+		order:        list.New(),
+		memoryBudget: memoryBudget,
+		maxFileSize:  maxFileSize,
+	}
+}
+
+func (cache *fileCache) get(path string) (*cachedFile, error) {
+	path = filepath.Clean(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, os.ErrNotExist
+	}
+
+	cache.lock.Lock()
+	if element, ok := cache.entries[path]; ok {
+		entry := element.Value.(*cachedFile)
+		if entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+			cache.order.MoveToFront(element)
+			cache.lock.Unlock()
+			return entry, nil
+		}
+		cache.remove(element)
+	}
+	cache.lock.Unlock()
+
+	entry := &cachedFile{path: path, modTime: info.ModTime(), size: info.Size()}
+	if info.Size() <= cache.maxFileSize && info.Size() <= cache.memoryBudget {
+		if entry.content, err = ioutil.ReadAll(file); err != nil {
+			return nil, err
+		}
+		entry.eTag = getETag(entry.content)
+	} else {
+		entry.eTag = getFileInfoETag(info)
+	}
+	if cache.disabled {
+		return entry, nil
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if element, ok := cache.entries[path]; ok {
+		cache.remove(element)
+	}
+	cache.entries[path] = cache.order.PushFront(entry)
+	cache.used += entry.cost()
+	for cache.used > cache.memoryBudget && cache.order.Len() > 1 {
+		cache.remove(cache.order.Back())
+	}
+	return entry, nil
+}
+
+func (cache *fileCache) invalidate(path string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if element, ok := cache.entries[filepath.Clean(path)]; ok {
+		cache.remove(element)
+	}
+}
+
+func (cache *fileCache) invalidateAll() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries = map[string]*list.Element{}
+	cache.order.Init()
+	cache.used = 0
+}
+
+func (cache *fileCache) remove(element *list.Element) {
+	entry := cache.order.Remove(element).(*cachedFile)
+	delete(cache.entries, entry.path)
+	cache.used -= entry.cost()
+}
+
+// Metadata-only entries are still charged a small amount so that the number of entries stays bounded.
+func (entry *cachedFile) cost() int64 {
+	return int64(len(entry.content)+len(entry.path)) + 128
+}
@@ -2,32 +2,146 @@ package server
 
 import (
 	"bufio"
-	"fmt"
-	"io/ioutil"
+	"bytes"
+	"crypto/tls"
+	"io"
 	"log"
 	"net"
 	"os"
 	"segaline/src/http"
 	"segaline/src/util"
-	"strconv"
+	"segaline/src/watch"
 	"strings"
+	"sync"
 	"time"
 )
 
 type FileServer struct {
-	listener   net.Listener
-	acceptChan chan net.Conn
+	listeners    []net.Listener
+	listenerLock sync.Mutex
 
-	fileRoot     string
-	templateRoot string
+	defaultSite *site
+	sites       []*site
+
+	authRealms          []*authRealm
+	clientCertRules     []clientCertRule
+	corsPolicies        []*corsPolicy
+	securityPolicies    []*securityPolicy
+	rewriteEngine       *rewriteEngine
+	spaPolicies         []*spaPolicy
+	negotiationPolicies []*negotiationPolicy
+	bodyLimits          []bodyLimit
+	uploadPolicies      []*uploadPolicy
+	uploadLock          sync.Mutex
+	webDAVPolicies      []*webDAVPolicy
+	webDAVLocks         *webDAVLockStore
+	webDAVProperties    *webDAVPropertyStore
+	cachePolicies       []*cachePolicy
+	fileCache           *fileCache
+	directoryListings   *directoryListings
+	templates           *templateStore
+	watcher             watch.Watcher
+	liveReload          *liveReloadHub
 }
 
-func NewFileServer(fileRoot string, templateRoot string) Server {
-	return &FileServer{
-		acceptChan:   make(chan net.Conn),
-		fileRoot:     strings.TrimSuffix(fileRoot, "/"),
-		templateRoot: strings.TrimSuffix(templateRoot, "/"),
+func NewFileServer(fileRoot string, templateRoot string, config *Config) (Server, error) {
+	server := &FileServer{
+		defaultSite:       newDefaultSite(fileRoot, templateRoot),
+		fileCache:         newFileCache(util.DefaultFileCacheMemoryBudget, util.DefaultFileCacheMaxFileSize),
+		directoryListings: newDirectoryListings(),
+		webDAVLocks:       newWebDAVLockStore(),
+		webDAVProperties:  newWebDAVPropertyStore(),
+	}
+	if config != nil {
+		if err := server.configure(config); err != nil {
+			return nil, err
+		}
+	}
+
+	// Without live reload or a file cache, nothing needs to hear about changes, and templates are parsed on every use.
+	server.templates = newTemplateStore()
+	if server.liveReload != nil || !server.fileCache.disabled {
+		server.watchRoots()
 	}
+	return server, nil
+}
+
+func (server *FileServer) configure(config *Config) error {
+	if config.FileCache.MemoryBudget > 0 {
+		server.fileCache.memoryBudget = config.FileCache.MemoryBudget
+	}
+	if config.FileCache.MaxFileSize > 0 {
+		server.fileCache.maxFileSize = config.FileCache.MaxFileSize
+	}
+	server.fileCache.disabled = config.FileCache.Disabled
+
+	for _, siteConfig := range config.Sites {
+		site, err := newSite(siteConfig, server.defaultSite)
+		if err != nil {
+			return err
+		}
+		server.sites = append(server.sites, site)
+	}
+	for index, siteConfig := range config.Sites {
+		if siteConfig.Default {
+			server.defaultSite = server.sites[index]
+		}
+	}
+
+	for _, authConfig := range config.Auth {
+		realm, err := newAuthRealm(authConfig)
+		if err != nil {
+			return err
+		}
+		server.authRealms = append(server.authRealms, realm)
+	}
+	for _, ruleConfig := range config.ClientCertRules {
+		server.clientCertRules = append(server.clientCertRules, newClientCertRule(ruleConfig))
+	}
+	for _, corsConfig := range config.CORS {
+		policy, err := newCORSPolicy(corsConfig)
+		if err != nil {
+			return err
+		}
+		server.corsPolicies = append(server.corsPolicies, policy)
+	}
+	for _, securityConfig := range config.SecurityHeaders {
+		server.securityPolicies = append(server.securityPolicies, newSecurityPolicy(securityConfig))
+	}
+	for _, cacheConfig := range config.CachePolicies {
+		server.cachePolicies = append(server.cachePolicies, newCachePolicy(cacheConfig))
+	}
+	for _, spaConfig := range config.SPA {
+		server.spaPolicies = append(server.spaPolicies, newSPAPolicy(spaConfig))
+	}
+	for _, negotiationConfig := range config.Negotiation {
+		server.negotiationPolicies = append(server.negotiationPolicies, newNegotiationPolicy(negotiationConfig))
+	}
+	for _, limitConfig := range config.BodyLimits {
+		server.bodyLimits = append(server.bodyLimits, newBodyLimit(limitConfig))
+	}
+	for _, uploadConfig := range config.Uploads {
+		server.uploadPolicies = append(server.uploadPolicies, newUploadPolicy(uploadConfig))
+	}
+	// WebDAV clients store files with `PUT`, so a WebDAV path also accepts uploads unless it has its own policy.
+	for _, webDAVConfig := range config.WebDAV {
+		server.webDAVPolicies = append(server.webDAVPolicies, newWebDAVPolicy(webDAVConfig))
+		server.uploadPolicies = append(server.uploadPolicies, newUploadPolicy(UploadConfig{
+			PathPrefix:  webDAVConfig.PathPrefix,
+			MaxFileSize: webDAVConfig.MaxFileSize,
+		}))
+	}
+	if config.LiveReload {
+		server.liveReload = newLiveReloadHub()
+	}
+	if len(config.RewriteRules) > 0 || config.RewriteRuleFile != "" {
+		engine, err := newRewriteEngine(config.RewriteRules, config.RewriteRuleFile)
+		if err != nil {
+			return err
+		}
+		server.rewriteEngine = engine
+	}
+	return nil
 }
 
 func (server *FileServer) Start(addr string) error {
@@ -35,58 +149,145 @@ func (server *FileServer) Start(addr string) error {
 	if err != nil {
 		return err
 	}
+	return server.Serve(listener)
+}
 
-	server.listener = listener
+func (server *FileServer) StartTLS(addr string, config TLSConfig) error {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return err
+	}
+
+	listener, err := tls.Listen("tcp", addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serves connections accepted from a listener until it is closed, for listeners created elsewhere, such as on an
+// ephemeral port.
+func (server *FileServer) Serve(listener net.Listener) error {
+	server.listenerLock.Lock()
+	server.listeners = append(server.listeners, listener)
+	server.listenerLock.Unlock()
+
+	acceptChan := make(chan net.Conn)
 	go func() {
 		for {
-			conn, err := server.listener.Accept()
+			conn, err := listener.Accept()
 			if err != nil {
-				close(server.acceptChan)
+				close(acceptChan)
 				break
 			}
-			server.acceptChan <- conn
+			acceptChan <- conn
 		}
 	}()
 
-	for conn := range server.acceptChan {
+	for conn := range acceptChan {
 		go server.handleClient(conn)
 	}
 	return nil
 }
 
-func (server *FileServer) Stop() error {
-	return server.listener.Close()
+// Serves requests on a single connection until either side closes it.
+func (server *FileServer) ServeConn(conn net.Conn) {
+	server.handleClient(conn)
+}
+
+func (server *FileServer) Stop() (err error) {
+	server.listenerLock.Lock()
+	defer server.listenerLock.Unlock()
+
+	for _, listener := range server.listeners {
+		if closeErr := listener.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	server.listeners = nil
+
+	if server.watcher != nil {
+		if closeErr := server.watcher.Close(); closeErr != nil {
+			err = closeErr
+		}
+		server.watcher = nil
+	}
+	return
 }
 
 func (server *FileServer) handleClient(conn net.Conn) {
 	defer server.closeConnectionLog(conn)
+	reader := bufio.NewReader(conn)
 	writer := bufio.NewWriterSize(conn, util.ResponseWriterBufferSize)
 
-	for req, ok := server.parseRequest(conn, writer); ok; req, ok = server.parseRequest(conn, writer) {
-		var willClose bool
-		if req.Method == http.MethodTrace {
-			willClose = server.handleTraceRequest(&req, writer)
-		} else {
-			willClose = server.handleGetOrHeadRequest(&req, writer)
-		}
+	for req, ok := server.parseRequest(conn, reader, writer); ok; req, ok = server.parseRequest(conn, reader, writer) {
+		willClose := server.handleRequest(&req, writer)
 
-		if willClose {
+		// Whatever is left of the body has to be discarded before the next request can be read.
+		if err := req.Body.Close(); err != nil || willClose {
 			break
 		}
 	}
 }
 
-func (server *FileServer) parseRequest(conn net.Conn, writer *bufio.Writer) (req http.Request, ok bool) {
+func (server *FileServer) handleRequest(req *http.Request, writer *bufio.Writer) (willClose bool) {
+	if !server.checkSite(req, writer) || !server.applyRewriteRules(req, writer) || !server.checkBodyLimit(req, writer) {
+		return req.WillCloseConnection()
+	}
+
+	if isCORSPreflight(req) {
+		return server.handleCORSPreflight(req, writer)
+	}
+
+	if !server.checkClientCert(req, writer) || !server.authenticate(req, writer) {
+		return req.WillCloseConnection()
+	}
+
+	// Methods are checked again since rewrite rules may have moved the request to a path that does not allow them.
+	if !containsMethod(server.allowedMethods(req), req.Method) {
+		server.respondErrorTemplate(writer, req, http.StatusMethodNotAllowed, false)
+		return req.WillCloseConnection()
+	}
+
+	// The event stream reveals which files change, so it is only served to clients that may see the files.
+	if server.liveReload != nil {
+		if handled, willClose := server.handleLiveReloadRequest(req, writer); handled || willClose {
+			return willClose
+		}
+	}
+
+	switch req.Method {
+	case http.MethodTrace:
+		return server.handleTraceRequest(req, writer)
+	case http.MethodOptions:
+		return server.handleOptionsRequest(req, writer)
+	case http.MethodPut:
+		return server.handlePutRequest(req, writer)
+	case http.MethodPost:
+		return server.handlePostRequest(req, writer)
+	case http.MethodDelete, http.MethodPropfind, http.MethodProppatch, http.MethodMkcol, http.MethodCopy,
+		http.MethodMove, http.MethodLock, http.MethodUnlock:
+		return server.handleWebDAVRequest(req, writer)
+	default:
+		return server.handleGetOrHeadRequest(req, writer)
+	}
+}
+
+func (server *FileServer) parseRequest(
+	conn net.Conn,
+	reader *bufio.Reader,
+	writer *bufio.Writer,
+) (req http.Request, ok bool) {
 	var err error
-	req, err = http.ParseRequest(conn)
+	req, err = http.ParseRequest(conn, reader)
 
 	if err == nil {
-		switch req.Method {
-		case http.MethodGet, http.MethodHead, http.MethodTrace:
-			ok = true
-		default:
+		if ok = containsMethod(server.allowedMethods(&req), req.Method); !ok {
 			server.respondErrorTemplate(writer, &req, http.StatusMethodNotAllowed, true)
 		}
+	} else if err == io.EOF {
+		// The client closed the connection between requests, so there is no one left to respond to.
+		return
 	} else {
 		var status http.StatusCode
 		switch err.Error() {
@@ -107,80 +308,164 @@ func (server *FileServer) parseRequest(conn net.Conn, writer *bufio.Writer) (req
 }
 
 func (server *FileServer) handleGetOrHeadRequest(req *http.Request, writer *bufio.Writer) bool {
-	pathString := req.Uri.PathString()
-	if pathString == "/" {
-		pathString = util.DefaultEmptyRequestTarget
+	pathString, filePath := server.resolvePath(req)
+	chosen, variants, handled := server.negotiateVariant(req, writer, pathString, filePath)
+	if handled {
+		return req.WillCloseConnection()
+	}
+	if chosen != nil {
+		pathString, filePath = chosen.pathString, chosen.filePath
 	}
-	filePath := server.fileRoot + pathString
-	content, err := ioutil.ReadFile(filePath)
+	file, err := server.fileCache.get(filePath)
+
+	var spa *spaPolicy
 	if err != nil {
-		server.respondErrorTemplate(writer, req, http.StatusNotFound, false)
-		return false
+		if spa = server.spaPolicyFor(req); spa != nil {
+			site, _ := server.siteFor(req)
+			pathString, filePath = spa.fallback, site.fileRoot+spa.fallback
+			file, err = server.fileCache.get(filePath)
+		}
+		if err != nil {
+			server.respondErrorTemplate(writer, req, http.StatusNotFound, false)
+			return false
+		}
 	}
+
+	content := file.content
 	contentType := server.contentTypeByExt(pathString[strings.LastIndex(pathString, ".")+1:])
+	if chosen != nil {
+		contentType = chosen.mediaType
+	}
 
-	res := http.NewResponse(req).WithStatus(http.StatusOK)
-	if len(content) <= util.ResponseMaxUnchunkedBody {
-		eTag := "\"" + getETag(content) + "\""
-		res.WithHeader(http.HeaderETag, eTag)
-		if result := server.eTagConditionalsPassed(req, eTag); result != ConditionalHeadersPassed {
-			return server.respondConditional(writer, result, req)
-		}
+	res, nonce := server.newResponseWithNonce(req, pathString)
+	res.WithStatus(http.StatusOK)
+	if chosen != nil {
+		applyVariantHeaders(res, variants, chosen)
 	}
-	if info, err := os.Stat(filePath); err == nil {
-		res.WithHeader(http.HeaderLastModified, formatTimeGMT(info.ModTime()))
-		if result := server.dateConditionalsPassed(req, info.ModTime()); result != ConditionalHeadersPassed {
-			return server.respondConditional(writer, result, req)
+	// A fallback document is cached by the policy for its own path, or by the SPA's `Cache-Control` when no policy
+	// covers it, so that the headers of the two never mix.
+	if !server.applyCachePolicy(res, pathString, contentType) && spa != nil {
+		res.WithHeader(http.HeaderCacheControl, spa.cacheControl)
+	}
+	if spa != nil {
+		addVary(res, string(http.HeaderAccept))
+	}
+
+	// Documents with a per-response nonce differ on every request, so they cannot be validated. This includes any
+	// document the live reload script is injected into, since the script needs the nonce as well.
+	placeholder := []byte(util.CSPNoncePlaceholder)
+	usesNonce := bytes.Contains(content, placeholder) || server.liveReload != nil && content != nil
+	if nonce != "" && contentType == http.MediaTypeHTML && usesNonce {
+		if req.Method == http.MethodGet {
+			content = bytes.ReplaceAll(content, placeholder, []byte(nonce))
+			res.WithBody(server.injectScripts(content, contentType, nonce), contentType)
 		}
+		res.Respond(writer)
+		return req.WillCloseConnection()
+	}
+
+	eTag := "\"" + file.eTag + "\""
+	res.WithHeader(http.HeaderETag, eTag)
+	if result := server.eTagConditionalsPassed(req, eTag); result != ConditionalHeadersPassed {
+		return server.respondConditional(writer, result, req, res)
+	}
+
+	res.WithHeader(http.HeaderLastModified, formatTimeGMT(file.modTime))
+	if result := server.dateConditionalsPassed(req, file.modTime); result != ConditionalHeadersPassed {
+		return server.respondConditional(writer, result, req, res)
+	}
+	if req.Method == http.MethodGet && content == nil {
+		return server.respondLargeFile(req, writer, res, file, contentType)
 	}
 	if req.Method == http.MethodGet {
-		res.WithBody(content, contentType)
+		res.WithBody(server.injectScripts(content, contentType, nonce), contentType)
 	}
 
 	res.Respond(writer)
 	return req.WillCloseConnection()
 }
 
-func (*FileServer) handleTraceRequest(req *http.Request, writer *bufio.Writer) bool {
-	http.NewResponse(req).WithStatus(http.StatusOK).WithBody(req.AsBytes(), http.MediaTypeHTTP).Respond(writer)
+// Files too large for the cache are copied from disk as they are sent, rather than read into memory first. If the
+// file changed since it was looked up, the validators are taken from the file that is actually sent.
+func (server *FileServer) respondLargeFile(
+	req *http.Request,
+	writer *bufio.Writer,
+	res *http.Response,
+	cached *cachedFile,
+	contentType http.MediaType,
+) bool {
+	file, err := os.Open(cached.path)
+	if err != nil {
+		server.respondErrorTemplate(writer, req, http.StatusNotFound, false)
+		return req.WillCloseConnection()
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		server.respondErrorTemplate(writer, req, http.StatusNotFound, false)
+		return req.WillCloseConnection()
+	}
+	if !info.ModTime().Equal(cached.modTime) || info.Size() != cached.size {
+		res.WithHeader(http.HeaderETag, "\""+getFileInfoETag(info)+"\"")
+		res.WithHeader(http.HeaderLastModified, formatTimeGMT(info.ModTime()))
+	}
+
+	res.WithHeader(http.HeaderContentType, string(contentType))
+	if err := res.RespondFrom(writer, file, info.Size()); err != nil {
+		return true
+	}
 	return req.WillCloseConnection()
 }
 
-func (*FileServer) eTagConditionalsPassed(req *http.Request, eTag string) (result ConditionalHeaderResult) {
-	result = ConditionalHeadersPassed
+// Responds with the server-wide methods for `OPTIONS *`, or with the methods allowed for an existing resource.
+func (server *FileServer) handleOptionsRequest(req *http.Request, writer *bufio.Writer) bool {
+	webDAV := req.Uri.Form() != http.FormAsterisk && server.webDAVPolicyFor(req.Uri.PathString()) != nil
+	if req.Uri.Form() != http.FormAsterisk {
+		_, filePath := server.resolvePath(req)
+		if _, webDAVPath := server.webDAVPaths(req); !fileExists(filePath) && !(webDAV && isDirectory(webDAVPath)) {
+			server.respondErrorTemplate(writer, req, http.StatusNotFound, false)
+			return req.WillCloseConnection()
+		}
+	}
 
-	if matchTagStrings, ok := req.Headers[string(http.HeaderIfMatch)]; ok {
-		if matchTagStrings == "*" {
-			result = ConditionalHeadersPassed
-		} else {
-			for _, tag := range strings.Split(matchTagStrings, ",") {
-				if strings.Trim(tag, util.RequestOWS) == eTag {
-					result = ConditionalHeadersPassed
-					break
-				}
-			}
-			if result == ConditionalHeadersFailed {
-				return
-			}
+	res := server.newResponse(req).
+		WithStatus(http.StatusOK).
+		WithHeader(http.HeaderAllow, formatMethods(server.allowedMethods(req)))
+	if webDAV {
+		res.WithHeader(http.HeaderDAV, "1, 2")
+	}
+	res.Respond(writer)
+	return req.WillCloseConnection()
+}
+
+func (server *FileServer) handleTraceRequest(req *http.Request, writer *bufio.Writer) bool {
+	server.newResponse(req).WithStatus(http.StatusOK).WithBody(req.AsBytes(), http.MediaTypeHTTP).Respond(writer)
+	return req.WillCloseConnection()
+}
+
+// An empty ETag means that there is no current representation, which `If-Match` never matches. For methods other
+// than GET and HEAD, a matching `If-None-Match` fails the request instead of reporting it as not modified.
+func (*FileServer) eTagConditionalsPassed(req *http.Request, eTag string) ConditionalHeaderResult {
+	if matchTagStrings, ok := req.Headers.Lookup(http.HeaderIfMatch); ok {
+		if eTag == "" || matchTagStrings != "*" && !containsETag(matchTagStrings, eTag, false) {
+			return ConditionalHeadersFailed
 		}
 	}
 
-	if matchTagStrings, ok := req.Headers[string(http.HeaderIfNoneMatch)]; ok {
-		if matchTagStrings == "*" {
-			return ConditionalHeadersNotModified
-		} else {
-			for _, tag := range strings.Split(matchTagStrings, ",") {
-				if strings.TrimPrefix(strings.Trim(tag, util.RequestOWS), "W/") == strings.TrimPrefix(eTag, "W/") {
-					return ConditionalHeadersNotModified
-				}
+	if matchTagStrings, ok := req.Headers.Lookup(http.HeaderIfNoneMatch); ok && eTag != "" {
+		if matchTagStrings == "*" || containsETag(matchTagStrings, eTag, true) {
+			if req.Method == http.MethodGet || req.Method == http.MethodHead {
+				return ConditionalHeadersNotModified
 			}
+			return ConditionalHeadersFailed
 		}
 	}
-	return
+	return ConditionalHeadersPassed
 }
 
 func (*FileServer) dateConditionalsPassed(req *http.Request, lastModified time.Time) (result ConditionalHeaderResult) {
-	if since, ok := req.Headers[string(http.HeaderIfUnmodifiedSince)]; ok {
+	if since, ok := req.Headers.Lookup(http.HeaderIfUnmodifiedSince); ok {
 		sinceTime, err := parseTimeGMT(since)
 		if err != nil || sinceTime.After(lastModified) || sinceTime.Equal(lastModified) {
 			result = ConditionalHeadersPassed
@@ -189,7 +474,7 @@ func (*FileServer) dateConditionalsPassed(req *http.Request, lastModified time.T
 		}
 	}
 
-	if since, ok := req.Headers[string(http.HeaderIfModifiedSince)]; ok {
+	if since, ok := req.Headers.Lookup(http.HeaderIfModifiedSince); ok {
 		result = ConditionalHeadersNotModified
 		sinceTime, err := parseTimeGMT(since)
 		if err != nil || sinceTime.Before(lastModified) {
@@ -199,13 +484,25 @@ func (*FileServer) dateConditionalsPassed(req *http.Request, lastModified time.T
 	return
 }
 
-func (server *FileServer) respondConditional(writer *bufio.Writer, r ConditionalHeaderResult, req *http.Request) bool {
+// Responds to a request whose conditional headers did not pass. A 304 response carries the validator and caching
+// headers that the full response would have had.
+func (server *FileServer) respondConditional(
+	writer *bufio.Writer,
+	r ConditionalHeaderResult,
+	req *http.Request,
+	full *http.Response,
+) bool {
 	willClose := req.WillCloseConnection()
 
 	if r == ConditionalHeadersFailed {
 		server.respondErrorTemplate(writer, req, http.StatusPreconditionFailed, willClose)
 	} else if r == ConditionalHeadersNotModified {
-		res := http.NewResponse(req).WithStatus(http.StatusNotModified)
+		res := server.newResponse(req).WithStatus(http.StatusNotModified)
+		for _, header := range []http.Header{http.HeaderETag, http.HeaderCacheControl, http.HeaderExpires, http.HeaderVary} {
+			if value, ok := full.Headers.Lookup(header); ok {
+				res.WithHeader(header, value)
+			}
+		}
 		if willClose {
 			res.WithHeader(http.HeaderConnection, string(http.ConnectionHeaderClose))
 		}
@@ -214,32 +511,55 @@ func (server *FileServer) respondConditional(writer *bufio.Writer, r Conditional
 	return willClose
 }
 
-func (server *FileServer) respondErrorTemplate(
-	writer *bufio.Writer,
-	req *http.Request,
-	status http.StatusCode,
-	close bool,
-) {
-	template, err := ioutil.ReadFile(server.templateRoot + "/error.html")
-	content := template
-	if err != nil {
-		content = []byte(util.DefaultFallbackErrorTemplate)
+func (server *FileServer) injectScripts(content []byte, contentType http.MediaType, nonce string) []byte {
+	if server.liveReload != nil && contentType == http.MediaTypeHTML {
+		return injectLiveReloadScript(content, nonce)
 	}
-	content = []byte(server.formatErrorTemplate(string(content), status))
+	return content
+}
 
-	res := http.NewResponse(req).WithStatus(status).WithBody(content, http.MediaTypeHTML)
-	if close {
-		res.WithHeader(http.HeaderConnection, string(http.ConnectionHeaderClose))
+// The methods supported for the target of a request. This is the single source for `Allow` headers and for
+// rejecting methods the server does not handle. `OPTIONS *` asks about the server as a whole, so it only gets the
+// methods that are allowed everywhere, even though its path is `/`.
+func (server *FileServer) allowedMethods(req *http.Request) []http.Method {
+	methods := []http.Method{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}
+	if req.Uri.Form() == http.FormAsterisk {
+		return methods
 	}
-	if status == http.StatusMethodNotAllowed {
-		res.WithHeader(http.HeaderAllow, fmt.Sprintf("%s, %s, %s", http.MethodGet, http.MethodHead, http.MethodTrace))
+	if server.uploadPolicyFor(req.Uri.PathString()) != nil {
+		methods = append(methods, http.MethodPut, http.MethodPost)
 	}
-	res.Respond(writer)
+	if server.webDAVPolicyFor(req.Uri.PathString()) != nil {
+		methods = append(methods, webDAVMethods...)
+	}
+	return methods
+}
+
+func (server *FileServer) resolvePath(req *http.Request) (pathString string, filePath string) {
+	site, _ := server.siteFor(req)
+	return site.resolvePath(req.Uri.PathString())
+}
+
+// Creates a response with the headers from any policies configured for the request.
+func (server *FileServer) newResponse(req *http.Request) *http.Response {
+	res, _ := server.newResponseWithNonce(req, req.Uri.PathString())
+	return res
+}
+
+// Security headers are chosen by the path of the file that is served, which handlers pass once they have resolved it.
+func (server *FileServer) newResponseWithNonce(req *http.Request, pathString string) (*http.Response, string) {
+	res := http.NewResponse(req)
+	server.applyCORSHeaders(req, res)
+	return res, server.applySecurityHeaders(req, res, pathString)
 }
 
-func (*FileServer) formatErrorTemplate(template string, status http.StatusCode) string {
-	statusReplaced := strings.ReplaceAll(template, "{statusCode}", strconv.Itoa(int(status)))
-	return strings.ReplaceAll(statusReplaced, "{serverInfo}", util.ServerNameVersion)
+func (server *FileServer) respondErrorTemplate(
+	writer *bufio.Writer,
+	req *http.Request,
+	status http.StatusCode,
+	close bool,
+) {
+	server.newErrorResponse(req, status, close).Respond(writer)
 }
 
 func (*FileServer) closeConnectionLog(conn net.Conn) {
@@ -0,0 +1,200 @@
+package server_test
+
+import (
+	"path/filepath"
+	"segaline/src/client"
+	"segaline/src/http"
+	"segaline/src/segalinetest"
+	"segaline/src/server"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFileServing(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).
+		WriteFile("index.html", "<h1>Home</h1>").
+		WriteFile("docs/readme.txt", "read me")
+	testServer := segalinetest.NewServer(t, fixture, nil)
+
+	cases := []struct {
+		name    string
+		req     *segalinetest.Request
+		status  http.StatusCode
+		body    *string
+		headers map[http.Header]string
+	}{
+		{"get", segalinetest.Get("/docs/readme.txt"), http.StatusOK, stringPtr("read me"), nil},
+		{"index", segalinetest.Get("/"), http.StatusOK, stringPtr("<h1>Home</h1>"), nil},
+		{"head", segalinetest.Head("/docs/readme.txt"), http.StatusOK, stringPtr(""), nil},
+		{"missing", segalinetest.Get("/missing.txt"), http.StatusNotFound, nil, nil},
+		{"traversal", segalinetest.Get("/../index.html"), http.StatusOK, stringPtr("<h1>Home</h1>"), nil},
+		{"not modified", segalinetest.Get("/docs/readme.txt").WithHeader(http.HeaderIfNoneMatch, "*"),
+			http.StatusNotModified, stringPtr(""), nil},
+		{"precondition failed", segalinetest.Get("/docs/readme.txt").WithHeader(http.HeaderIfMatch, `"other"`),
+			http.StatusPreconditionFailed, nil, nil},
+		{"put without uploads", segalinetest.NewRequest(http.MethodPut, "/new.txt").WithBody("new", "text/plain"),
+			http.StatusMethodNotAllowed, nil, map[http.Header]string{http.HeaderAllow: "GET, HEAD, OPTIONS, TRACE"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := testServer.Do(c.req).AssertStatus(c.status)
+			if c.body != nil {
+				result.AssertBody(*c.body)
+			}
+			for header, value := range c.headers {
+				result.AssertHeader(header, value)
+			}
+		})
+	}
+}
+
+func TestUploadsOverKeepAlive(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).Mkdir("uploads")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		Uploads: []server.UploadConfig{{PathPrefix: "/uploads"}},
+	})
+
+	results := testServer.DoAll(
+		segalinetest.NewRequest(http.MethodPut, "/uploads/a.txt").WithChunkedBody("chunked", "text/plain"),
+		segalinetest.Get("/uploads/a.txt"),
+		segalinetest.Get("/uploads/b.txt"),
+	)
+	results[0].AssertStatus(http.StatusCreated)
+	results[1].AssertStatus(http.StatusOK).AssertBody("chunked")
+	results[2].AssertStatus(http.StatusNotFound)
+
+	if content, ok := fixture.ReadFile("uploads/a.txt"); !ok || content != "chunked" {
+		t.Errorf("expected the upload to be stored, got %q", content)
+	}
+}
+
+func TestMalformedRequest(t *testing.T) {
+	testServer := segalinetest.NewServer(t, segalinetest.NewFixture(t), nil)
+	testServer.DoRaw("GET /index.html HTTP/1.1\r\nHost: localhost\r\nBad Header\r\n\r\n").
+		AssertStatus(http.StatusBadRequest)
+}
+
+func TestListeningServer(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteFile("hello.txt", "hello")
+	testServer := segalinetest.NewListeningServer(t, fixture, nil)
+
+	res, err := client.NewClient().Get(testServer.URL + "/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || string(res.Body) != "hello" {
+		t.Errorf("expected 200 with body %q, got %d with %q", "hello", res.StatusCode, res.Body)
+	}
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
+
+func TestOptionsAsteriskIgnoresPathPolicies(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteTemplate("users", "")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		Uploads: []server.UploadConfig{{PathPrefix: "/"}},
+		WebDAV:  []server.WebDAVConfig{{PathPrefix: "/"}},
+		Auth: []server.AuthConfig{{
+			PathPrefix: "/",
+			Realm:      "all",
+			Scheme:     "basic",
+			UserFile:   filepath.Join(fixture.TemplateRoot, "users"),
+		}},
+	})
+	testServer.DoRaw("OPTIONS * HTTP/1.1\r\nHost: localhost\r\n\r\n").
+		AssertStatus(http.StatusOK).
+		AssertHeader(http.HeaderAllow, "GET, HEAD, OPTIONS, TRACE").
+		AssertNoHeader(http.HeaderDAV)
+}
+
+func TestLargeFilesAreStreamed(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	fixture := segalinetest.NewFixture(t).WriteFile("large.txt", content)
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		FileCache: server.FileCacheConfig{MaxFileSize: 100},
+	})
+
+	result := testServer.Do(segalinetest.Get("/large.txt")).
+		AssertStatus(http.StatusOK).
+		AssertHeader(http.HeaderContentLength, strconv.Itoa(len(content))).
+		AssertHeaderContains(http.HeaderContentType, "text/plain").
+		AssertBody(content)
+	testServer.Do(segalinetest.Get("/large.txt").WithHeader(http.HeaderIfNoneMatch, result.Header(http.HeaderETag))).
+		AssertStatus(http.StatusNotModified)
+}
+
+func TestSiteWithoutFileRootInheritsDefault(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteFile("hello.txt", "hello")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		FileCache: server.FileCacheConfig{Disabled: true},
+		Sites:     []server.SiteConfig{{Hosts: []string{"example.com"}}},
+	})
+
+	testServer.Do(segalinetest.Get("/hello.txt").WithHeader(http.HeaderHost, "example.com")).
+		AssertStatus(http.StatusOK).
+		AssertBody("hello")
+	testServer.Do(segalinetest.Get("/etc/hostname").WithHeader(http.HeaderHost, "example.com")).
+		AssertStatus(http.StatusNotFound)
+}
+
+func TestSPAFallbackUsesItsOwnCachePolicy(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteFile("index.html", "<h1>App</h1>")
+	maxAge := 60
+	spa := []server.SPAConfig{{PathPrefix: "/app", Fallback: "/index.html"}}
+	route := segalinetest.Get("/app/settings").WithHeader(http.HeaderAccept, "text/html")
+
+	routeServer := segalinetest.NewServer(t, fixture, &server.Config{
+		FileCache:     server.FileCacheConfig{Disabled: true},
+		SPA:           spa,
+		CachePolicies: []server.CachePolicyConfig{{PathGlob: "/app/**", MaxAge: &maxAge}},
+	})
+	routeServer.Do(route).
+		AssertStatus(http.StatusOK).
+		AssertHeader(http.HeaderCacheControl, "no-cache").
+		AssertNoHeader(http.HeaderExpires)
+
+	documentServer := segalinetest.NewServer(t, fixture, &server.Config{
+		FileCache:     server.FileCacheConfig{Disabled: true},
+		SPA:           spa,
+		CachePolicies: []server.CachePolicyConfig{{Extensions: []string{"html"}, MaxAge: &maxAge}},
+	})
+	result := documentServer.Do(route).
+		AssertStatus(http.StatusOK).
+		AssertHeader(http.HeaderCacheControl, "max-age=60")
+	if result.Header(http.HeaderExpires) == "" {
+		t.Error("expected the Expires header of the fallback document's policy")
+	}
+}
+
+func TestErrorTemplatesAreParsedOnce(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteTemplate("404.html", "first {{.StatusCode}}")
+	testServer := segalinetest.NewServer(t, fixture, nil)
+
+	testServer.Do(segalinetest.Get("/missing")).AssertStatus(http.StatusNotFound).AssertBody("first 404")
+	fixture.WriteTemplate("404.html", "second {{.StatusCode}}")
+	testServer.Do(segalinetest.Get("/missing")).AssertStatus(http.StatusNotFound).AssertBody("first 404")
+}
+
+func TestPutPreconditions(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteFile("uploads/a.txt", "old")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		Uploads: []server.UploadConfig{{PathPrefix: "/uploads"}},
+	})
+
+	eTag := testServer.Do(segalinetest.Get("/uploads/a.txt")).AssertStatus(http.StatusOK).Header(http.HeaderETag)
+	put := func(body string) *segalinetest.Request {
+		return segalinetest.NewRequest(http.MethodPut, "/uploads/a.txt").
+			WithHeader(http.HeaderIfMatch, eTag).
+			WithBody(body, "text/plain")
+	}
+	testServer.Do(put("newer")).AssertStatus(http.StatusNoContent)
+	testServer.Do(put("newest")).AssertStatus(http.StatusPreconditionFailed)
+
+	if content, _ := fixture.ReadFile("uploads/a.txt"); content != "newer" {
+		t.Errorf("expected the first upload to be stored, got %q", content)
+	}
+}
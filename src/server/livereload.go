@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"segaline/src/http"
+	"segaline/src/util"
+	"segaline/src/watch"
+	"strings"
+	"sync"
+	"time"
+)
+
+const liveReloadScript = `(function () {
+  var source = new EventSource("` + util.LiveReloadEventPath + `");
+  source.addEventListener("css", function (event) {
+    var links = document.querySelectorAll('link[rel="stylesheet"]');
+    var swapped = false;
+    for (var i = 0; i < links.length; i++) {
+      var url = new URL(links[i].href, location.href);
+      if (url.origin === location.origin && url.pathname === event.data) {
+        url.searchParams.set("livereload", Date.now());
+        links[i].href = url.href;
+        swapped = true;
+      }
+    }
+    if (!swapped) {
+      location.reload();
+    }
+  });
+  source.addEventListener("reload", function () {
+    location.reload();
+  });
+})();
+`
+
+type liveReloadEvent struct {
+	name string
+	path string
+}
+
+// Tracks the event streams of connected browsers, which are notified whenever a file under a root changes.
+type liveReloadHub struct {
+	clients map[chan liveReloadEvent]bool
+	lock    sync.Mutex
+}
+
+func newLiveReloadHub() *liveReloadHub {
+	return &liveReloadHub{clients: map[chan liveReloadEvent]bool{}}
+}
+
+func (hub *liveReloadHub) subscribe() chan liveReloadEvent {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	events := make(chan liveReloadEvent, 16)
+	hub.clients[events] = true
+	return events
+}
+
+func (hub *liveReloadHub) unsubscribe(events chan liveReloadEvent) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	delete(hub.clients, events)
+}
+
+// Slow clients miss events rather than blocking the watcher, which is fine since any later event reloads them.
+func (hub *liveReloadHub) broadcast(event liveReloadEvent) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	for events := range hub.clients {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// Changes to stylesheets under a file root are hot-swapped by URL path, and anything else causes a full reload.
+func (server *FileServer) handleLiveReloadEvent(event watch.Event) {
+	if !event.IsDir && event.Kind != watch.EventRemoved && strings.EqualFold(filepath.Ext(event.Path), ".css") {
+		for _, site := range append([]*site{server.defaultSite}, server.sites...) {
+			root := filepath.Clean(site.fileRoot)
+			if strings.HasPrefix(event.Path, root+string(filepath.Separator)) {
+				urlPath := http.EncodePercent(filepath.ToSlash(event.Path[len(root):]), http.UriComponentPath)
+				server.liveReload.broadcast(liveReloadEvent{"css", urlPath})
+				return
+			}
+		}
+	}
+	server.liveReload.broadcast(liveReloadEvent{"reload", ""})
+}
+
+// Serves the live reload script and event stream, returning false if the request is for neither. Both only answer
+// GET and HEAD, where HEAD gets the headers without a body or a stream.
+func (server *FileServer) handleLiveReloadRequest(req *http.Request, writer *bufio.Writer) (handled bool, willClose bool) {
+	pathString := req.Uri.PathString()
+	if pathString != util.LiveReloadScriptPath && pathString != util.LiveReloadEventPath {
+		return false, false
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		server.newErrorResponse(req, http.StatusMethodNotAllowed, false).
+			WithHeader(http.HeaderAllow, formatMethods([]http.Method{http.MethodGet, http.MethodHead})).
+			Respond(writer)
+		return true, req.WillCloseConnection()
+	}
+
+	switch {
+	case pathString == util.LiveReloadScriptPath:
+		res := server.newResponse(req).WithStatus(http.StatusOK).WithHeader(http.HeaderCacheControl, "no-cache")
+		if req.Method == http.MethodGet {
+			res.WithBody([]byte(liveReloadScript), http.MediaTypeJavaScript)
+		}
+		res.Respond(writer)
+	case req.Method == http.MethodHead:
+		server.newResponse(req).
+			WithStatus(http.StatusOK).
+			WithHeader(http.HeaderContentType, string(http.MediaTypeEventStream)).
+			WithHeader(http.HeaderCacheControl, "no-store").
+			Respond(writer)
+	default:
+		server.streamLiveReloadEvents(req, writer)
+		return true, true
+	}
+	return true, req.WillCloseConnection()
+}
+
+// Holds the connection open, sending an event for every change and periodic comments to detect closed connections.
+func (server *FileServer) streamLiveReloadEvents(req *http.Request, writer *bufio.Writer) {
+	events := server.liveReload.subscribe()
+	defer server.liveReload.unsubscribe(events)
+
+	server.newResponse(req).
+		WithStatus(http.StatusOK).
+		WithHeader(http.HeaderContentType, string(http.MediaTypeEventStream)).
+		WithHeader(http.HeaderCacheControl, "no-store").
+		WithHeader(http.HeaderConnection, string(http.ConnectionHeaderClose)).
+		RespondStreamed(writer)
+
+	heartbeat := time.NewTicker(util.LiveReloadHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var message string
+		select {
+		case event := <-events:
+			message = fmt.Sprintf("event: %s\ndata: %s\n\n", event.name, event.path)
+		case <-heartbeat.C:
+			message = ":\n\n"
+		}
+		if err := http.WriteChunk(writer, []byte(message)); err != nil {
+			return
+		}
+	}
+}
+
+// Inserts the live reload script before the closing body tag of an HTML document, or at its end if there is none.
+// The script carries the nonce of the response's content security policy, if it has one.
+func injectLiveReloadScript(content []byte, nonce string) []byte {
+	attributes := ""
+	if nonce != "" {
+		attributes = ` nonce="` + nonce + `"`
+	}
+	tag := []byte(`<script src="` + util.LiveReloadScriptPath + `"` + attributes + `></script>`)
+	index := bytes.LastIndex(bytes.ToLower(content), []byte("</body>"))
+	if index < 0 {
+		return append(append([]byte{}, content...), tag...)
+	}
+
+	injected := make([]byte, 0, len(content)+len(tag))
+	injected = append(injected, content[:index]...)
+	injected = append(injected, tag...)
+	return append(injected, content[index:]...)
+}
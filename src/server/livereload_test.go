@@ -0,0 +1,56 @@
+package server_test
+
+import (
+	"path/filepath"
+	"segaline/src/http"
+	"segaline/src/segalinetest"
+	"segaline/src/server"
+	"strings"
+	"testing"
+)
+
+func TestLiveReloadRequiresAuthentication(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteTemplate("users", "")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		LiveReload: true,
+		Auth: []server.AuthConfig{{
+			PathPrefix: "/",
+			Realm:      "all",
+			Scheme:     "basic",
+			UserFile:   filepath.Join(fixture.TemplateRoot, "users"),
+		}},
+	})
+	testServer.Do(segalinetest.Get("/__segaline/livereload.js")).AssertStatus(http.StatusUnauthorized)
+}
+
+func TestLiveReloadScriptCarriesNonce(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteFile("index.html", "<body>Home</body>")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		LiveReload: true,
+		SecurityHeaders: []server.SecurityHeadersConfig{{
+			PathPrefix:            "/",
+			ContentSecurityPolicy: "script-src 'nonce-{cspNonce}'",
+		}},
+	})
+
+	result := testServer.Do(segalinetest.Get("/index.html")).AssertStatus(http.StatusOK).AssertNoHeader(http.HeaderETag)
+	policy := result.Header(http.HeaderContentSecurityPolicy)
+	nonce := strings.TrimSuffix(strings.TrimPrefix(policy, "script-src 'nonce-"), "'")
+	result.AssertBodyContains(`<script src="/__segaline/livereload.js" nonce="` + nonce + `"></script></body>`)
+}
+
+func TestLiveReloadOnlyAnswersGetAndHead(t *testing.T) {
+	testServer := segalinetest.NewServer(t, segalinetest.NewFixture(t), &server.Config{
+		LiveReload: true,
+		Uploads:    []server.UploadConfig{{PathPrefix: "/"}},
+	})
+
+	testServer.Do(segalinetest.Head("/__segaline/livereload.js")).AssertStatus(http.StatusOK).AssertBody("")
+	testServer.Do(segalinetest.Head("/__segaline/livereload")).
+		AssertStatus(http.StatusOK).
+		AssertHeaderContains(http.HeaderContentType, "text/event-stream").
+		AssertBody("")
+	testServer.Do(segalinetest.NewRequest(http.MethodPost, "/__segaline/livereload.js").WithBody("x", "text/plain")).
+		AssertStatus(http.StatusMethodNotAllowed).
+		AssertHeader(http.HeaderAllow, "GET, HEAD")
+}
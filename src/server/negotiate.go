@@ -0,0 +1,424 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type qualityValue struct {
+	value   string
+	quality float64
+}
+
+// Parses a list like the `Accept` or `Accept-Language` header values, where each element may have a `q` parameter.
+// Invalid quality values are treated as zero.
+func parseQualityList(header string) []qualityValue {
+	var values []qualityValue
+	for _, element := range strings.Split(header, ",") {
+		params := strings.Split(element, ";")
+		value := strings.ToLower(strings.Trim(params[0], util.RequestOWS))
+		if value == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.Trim(param, util.RequestOWS)
+			if strings.HasPrefix(strings.ToLower(param), "q=") {
+				var err error
+				if quality, err = strconv.ParseFloat(param[2:], 64); err != nil || quality < 0 || quality > 1 {
+					quality = 0
+				}
+			}
+		}
+		values = append(values, qualityValue{value, quality})
+	}
+	return values
+}
+
+// Returns the quality of the most specific media range in an `Accept` header matching a media type.
+func mediaTypeQuality(accept string, mediaType http.MediaType) float64 {
+	mediaTypeString := strings.ToLower(string(mediaType))
+	slash := strings.Index(mediaTypeString, "/")
+
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range parseQualityList(accept) {
+		rangeSpecificity := -1
+		switch {
+		case mediaRange.value == mediaTypeString:
+			rangeSpecificity = 2
+		case slash >= 0 && mediaRange.value == mediaTypeString[:slash]+"/*":
+			rangeSpecificity = 1
+		case mediaRange.value == "*/*":
+			rangeSpecificity = 0
+		}
+		if rangeSpecificity > specificity {
+			quality, specificity = mediaRange.quality, rangeSpecificity
+		}
+	}
+	return quality
+}
+
+type negotiationPolicy struct {
+	pathPrefix      string
+	defaultLanguage string
+	strict          bool
+	multipleChoices bool
+}
+
+// A representation of a requested file, like `page.en.html` for `page.html`, or one listed in a type map.
+type variant struct {
+	pathString    string
+	filePath      string
+	mediaType     http.MediaType
+	language      string
+	sourceQuality float64
+}
+
+var languageTagRegex = regexp.MustCompile(`(?i)^[a-z]{2}(-[a-z0-9]{2,8})*$`)
+
+func newNegotiationPolicy(config NegotiationConfig) *negotiationPolicy {
+	return &negotiationPolicy{
+		pathPrefix:      strings.TrimSuffix(config.PathPrefix, "/"),
+		defaultLanguage: strings.ToLower(config.DefaultLanguage),
+		strict:          config.Strict,
+		multipleChoices: config.MultipleChoices,
+	}
+}
+
+func (server *FileServer) negotiationPolicyFor(pathString string) *negotiationPolicy {
+	var match *negotiationPolicy
+	for _, policy := range server.negotiationPolicies {
+		if hasPathPrefix(pathString, policy.pathPrefix) && (match == nil || len(policy.pathPrefix) > len(match.pathPrefix)) {
+			match = policy
+		}
+	}
+	return match
+}
+
+// Selects the variant to serve for a file that has variants, also returning all of them. If none fits the request,
+// or several fit equally well and the policy asks for it, this responds with the list of variants instead.
+func (server *FileServer) negotiateVariant(
+	req *http.Request,
+	writer *bufio.Writer,
+	pathString string,
+	filePath string,
+) (chosen *variant, variants []*variant, handled bool) {
+	policy := server.negotiationPolicyFor(pathString)
+	if policy == nil {
+		return nil, nil, false
+	}
+	if variants = server.findVariants(pathString, filePath); len(variants) == 0 {
+		return nil, nil, false
+	}
+
+	best := chooseVariants(req, variants)
+	switch {
+	case len(best) == 1:
+		return best[0], variants, false
+	case len(best) == 0 && policy.strict:
+		server.respondVariants(req, writer, http.StatusNotAcceptable, variants)
+		return nil, variants, true
+	case policy.multipleChoices:
+		server.respondVariants(req, writer, http.StatusMultipleChoices, variants)
+		return nil, variants, true
+	case len(best) == 0:
+		return policy.preferredVariant(variants), variants, false
+	default:
+		return policy.preferredVariant(best), variants, false
+	}
+}
+
+// Finds the variants of a file, from a type map named like the file with a `.var` extension, or else from the files
+// next to it. Files are variants by naming convention if they add a language tag before the extension, or, if the
+// requested name has no extension, if they only add one.
+func (server *FileServer) findVariants(pathString string, filePath string) []*variant {
+	dirPathString, dirPath := path.Dir(pathString), filepath.Dir(filePath)
+	children, err := server.directoryListings.get(dirPath)
+	if err != nil {
+		return nil
+	}
+	name := path.Base(pathString)
+	if containsString(children, name+".var") {
+		if content, err := ioutil.ReadFile(filePath + ".var"); err == nil {
+			return server.parseTypeMap(string(content), dirPathString, dirPath)
+		}
+	}
+
+	stem, ext := name, ""
+	if dot := strings.LastIndex(name, "."); dot > 0 {
+		stem, ext = name[:dot], name[dot+1:]
+	}
+
+	var variants []*variant
+	hasAlternatives := false
+	for _, childName := range children {
+		if strings.HasPrefix(childName, ".") || !strings.HasPrefix(childName+".", stem+".") {
+			continue
+		}
+
+		found := &variant{sourceQuality: 1}
+		parts := strings.Split(strings.TrimPrefix(childName, stem+"."), ".")
+		switch {
+		case childName == name:
+		case len(parts) == 2 && languageTagRegex.MatchString(parts[0]) && (ext == "" || parts[1] == ext):
+			found.language = parts[0]
+		case len(parts) == 1 && ext == "":
+		default:
+			continue
+		}
+
+		hasAlternatives = hasAlternatives || childName != name
+		found.pathString = path.Join(dirPathString, childName)
+		found.filePath = dirPath + "/" + childName
+		found.mediaType = server.contentTypeByExt(uploadExt(childName))
+		variants = append(variants, found)
+	}
+
+	if !hasAlternatives {
+		return nil
+	}
+	return variants
+}
+
+// The names of the files in directories where variants are looked for, so that directories are not listed again on
+// every request. Listings are revalidated against the directory's modification time, and dropped when the watcher
+// reports a change in the directory.
+type directoryListings struct {
+	entries map[string]directoryListing
+	lock    sync.RWMutex
+}
+
+type directoryListing struct {
+	modTime time.Time
+	names   []string
+}
+
+func newDirectoryListings() *directoryListings {
+	return &directoryListings{entries: map[string]directoryListing{}}
+}
+
+func (listings *directoryListings) get(dirPath string) ([]string, error) {
+	dirPath = filepath.Clean(dirPath)
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	listings.lock.RLock()
+	listing, ok := listings.entries[dirPath]
+	listings.lock.RUnlock()
+	if ok && listing.modTime.Equal(info.ModTime()) {
+		return listing.names, nil
+	}
+
+	children, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	listing = directoryListing{modTime: info.ModTime()}
+	for _, child := range children {
+		if !child.IsDir() {
+			listing.names = append(listing.names, child.Name())
+		}
+	}
+
+	listings.lock.Lock()
+	defer listings.lock.Unlock()
+	listings.entries[dirPath] = listing
+	return listing.names, nil
+}
+
+func (listings *directoryListings) invalidate(dirPath string) {
+	listings.lock.Lock()
+	defer listings.lock.Unlock()
+	delete(listings.entries, filepath.Clean(dirPath))
+}
+
+func (listings *directoryListings) invalidateAll() {
+	listings.lock.Lock()
+	defer listings.lock.Unlock()
+	listings.entries = map[string]directoryListing{}
+}
+
+// Parses a type map, which lists variants in records separated by blank lines, each with a `URI` naming a file in
+// the same directory and optionally a `Content-Type` with a `qs` source quality and a `Content-Language`.
+func (server *FileServer) parseTypeMap(content string, dirPathString string, dirPath string) []*variant {
+	var variants []*variant
+	for _, record := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		found := &variant{sourceQuality: 1}
+		name := ""
+		for _, line := range strings.Split(record, "\n") {
+			colon := strings.Index(line, ":")
+			if colon < 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			value := strings.Trim(line[colon+1:], util.RequestOWS)
+			switch strings.ToLower(strings.Trim(line[:colon], util.RequestOWS)) {
+			case "uri":
+				name = value
+			case "content-type":
+				if mediaType, params, err := mime.ParseMediaType(value); err == nil {
+					found.mediaType = http.MediaType(mediaType)
+					if quality, err := strconv.ParseFloat(params["qs"], 64); err == nil && quality >= 0 && quality <= 1 {
+						found.sourceQuality = quality
+					}
+				}
+			case "content-language":
+				found.language = strings.Trim(strings.Split(value, ",")[0], util.RequestOWS)
+			}
+		}
+
+		if name == "" || sanitizeFileName(name) != name || !fileExists(dirPath+"/"+name) {
+			continue
+		}
+		found.pathString = path.Join(dirPathString, name)
+		found.filePath = dirPath + "/" + name
+		if found.mediaType == "" {
+			found.mediaType = server.contentTypeByExt(uploadExt(name))
+		}
+		variants = append(variants, found)
+	}
+	return variants
+}
+
+// Scores variants by the product of their media type, language and source qualities, returning those with the best
+// score above zero. Missing `Accept` or `Accept-Language` headers accept anything.
+func chooseVariants(req *http.Request, variants []*variant) []*variant {
+	accept, hasAccept := req.Headers.Lookup(http.HeaderAccept)
+	acceptLanguage, hasAcceptLanguage := req.Headers.Lookup(http.HeaderAcceptLanguage)
+
+	var best []*variant
+	bestScore := 0.0
+	for _, found := range variants {
+		score := found.sourceQuality
+		if hasAccept {
+			score *= mediaTypeQuality(accept, found.mediaType)
+		}
+		if hasAcceptLanguage {
+			score *= languageQuality(acceptLanguage, found.language)
+		}
+
+		if score > bestScore {
+			best, bestScore = []*variant{found}, score
+		} else if score == bestScore && score > 0 {
+			best = append(best, found)
+		}
+	}
+	return best
+}
+
+// Returns the quality of the longest language range in an `Accept-Language` header matching a language tag. A
+// variant without a language is acceptable to everyone, but only as a last resort.
+func languageQuality(acceptLanguage string, language string) float64 {
+	if language == "" {
+		return 0.001
+	}
+	language = strings.ToLower(language)
+
+	quality, length := 0.0, -1
+	for _, languageRange := range parseQualityList(acceptLanguage) {
+		matches := languageRange.value == language || strings.HasPrefix(language, languageRange.value+"-")
+		if languageRange.value == "*" {
+			matches = true
+		}
+		if matches && len(languageRange.value) > length {
+			quality, length = languageRange.quality, len(languageRange.value)
+		}
+	}
+	return quality
+}
+
+// Breaks a tie between variants in favor of the default language, then a variant without a language.
+func (policy *negotiationPolicy) preferredVariant(variants []*variant) *variant {
+	for _, found := range variants {
+		if policy.defaultLanguage != "" && strings.ToLower(found.language) == policy.defaultLanguage {
+			return found
+		}
+	}
+	for _, found := range variants {
+		if found.language == "" {
+			return found
+		}
+	}
+	return variants[0]
+}
+
+// Adds `Vary` for each dimension the variants differ in, and describes the chosen variant if there is one.
+func applyVariantHeaders(res *http.Response, variants []*variant, chosen *variant) {
+	for _, found := range variants {
+		if found.mediaType != variants[0].mediaType {
+			addVary(res, string(http.HeaderAccept))
+		}
+		if !strings.EqualFold(found.language, variants[0].language) {
+			addVary(res, string(http.HeaderAcceptLanguage))
+		}
+	}
+
+	if chosen != nil {
+		if chosen.language != "" {
+			res.WithHeader(http.HeaderContentLanguage, chosen.language)
+		}
+		res.WithHeader(http.HeaderContentLocation, http.EncodePercent(chosen.pathString, http.UriComponentPath))
+	}
+}
+
+// Responds with a list of the variants, as JSON if the client prefers it and as links otherwise.
+func (server *FileServer) respondVariants(
+	req *http.Request,
+	writer *bufio.Writer,
+	status http.StatusCode,
+	variants []*variant,
+) {
+	res := server.newResponse(req).WithStatus(status)
+	applyVariantHeaders(res, variants, nil)
+	addVary(res, string(http.HeaderAccept))
+
+	type variantEntry struct {
+		Path      string `json:"path"`
+		MediaType string `json:"mediaType"`
+		Language  string `json:"language,omitempty"`
+	}
+	entries := make([]variantEntry, len(variants))
+	for index, found := range variants {
+		entries[index] = variantEntry{http.EncodePercent(found.pathString, http.UriComponentPath), string(found.mediaType), found.language}
+	}
+
+	if prefersJSON(req) {
+		content, _ := json.Marshal(map[string]interface{}{"variants": entries})
+		res.WithBody(content, http.MediaTypeJSON)
+	} else {
+		var content strings.Builder
+		content.WriteString("<!DOCTYPE html>\n<html><head><title>" + http.ReasonPhrase(status) + "</title></head><body>\n<ul>\n")
+		for _, entry := range entries {
+			description := entry.MediaType
+			if entry.Language != "" {
+				description += ", " + entry.Language
+			}
+			content.WriteString(fmt.Sprintf(
+				"<li><a href=\"%s\">%s</a> (%s)</li>\n",
+				html.EscapeString(entry.Path),
+				html.EscapeString(path.Base(entry.Path)),
+				html.EscapeString(description),
+			))
+		}
+		content.WriteString("</ul>\n</body></html>\n")
+		res.WithBody([]byte(content.String()), http.MediaTypeHTML)
+	}
+	res.Respond(writer)
+}
@@ -0,0 +1,29 @@
+package server_test
+
+import (
+	"segaline/src/http"
+	"segaline/src/segalinetest"
+	"segaline/src/server"
+	"testing"
+)
+
+func TestNegotiationSeesNewVariants(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).
+		WriteFile("docs/index.en.html", "english").
+		WriteFile("docs/index.de.html", "deutsch")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		Negotiation: []server.NegotiationConfig{{PathPrefix: "/docs", DefaultLanguage: "en"}},
+	})
+
+	testServer.Do(segalinetest.Get("/docs/index.html").WithHeader(http.HeaderAcceptLanguage, "de")).
+		AssertStatus(http.StatusOK).
+		AssertHeader(http.HeaderContentLanguage, "de").
+		AssertBody("deutsch")
+	testServer.Do(segalinetest.Get("/docs/index.html").WithHeader(http.HeaderAcceptLanguage, "fr")).
+		AssertBody("english")
+
+	fixture.WriteFile("docs/index.fr.html", "français")
+	testServer.Do(segalinetest.Get("/docs/index.html").WithHeader(http.HeaderAcceptLanguage, "fr")).
+		AssertHeader(http.HeaderContentLanguage, "fr").
+		AssertBody("français")
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type rewriteRule struct {
+	path    *regexp.Regexp
+	host    *regexp.Regexp
+	query   map[string]*regexp.Regexp
+	headers map[string]*regexp.Regexp
+
+	target   string
+	redirect bool
+	status   http.StatusCode
+}
+
+type rewriteEngine struct {
+	rules []*rewriteRule
+
+	// Rules from the rule file are evaluated after the inline rules, and are reloaded when the file changes.
+	file        string
+	fileRules   []*rewriteRule
+	fileModTime time.Time
+	lastCheck   time.Time
+	lock        sync.RWMutex
+}
+
+func newRewriteEngine(configs []RewriteRuleConfig, file string) (*rewriteEngine, error) {
+	rules, err := newRewriteRules(configs)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := &rewriteEngine{rules: rules, file: file}
+	if file != "" {
+		if err := engine.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return engine, nil
+}
+
+func newRewriteRules(configs []RewriteRuleConfig) ([]*rewriteRule, error) {
+	var rules []*rewriteRule
+	for _, config := range configs {
+		rule, err := newRewriteRule(config)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func newRewriteRule(config RewriteRuleConfig) (rule *rewriteRule, err error) {
+	rule = &rewriteRule{query: map[string]*regexp.Regexp{}, headers: map[string]*regexp.Regexp{}}
+
+	if rule.path, err = regexp.Compile(config.Path); err != nil {
+		return
+	}
+	if config.Host != "" {
+		if rule.host, err = regexp.Compile("(?i)" + config.Host); err != nil {
+			return
+		}
+	}
+	for name, pattern := range config.Query {
+		if rule.query[name], err = regexp.Compile(pattern); err != nil {
+			return
+		}
+	}
+	for name, pattern := range config.Headers {
+		if rule.headers[strings.ToLower(name)], err = regexp.Compile(pattern); err != nil {
+			return
+		}
+	}
+
+	switch {
+	case config.Rewrite != "" && config.Redirect == "":
+		rule.target = config.Rewrite
+	case config.Redirect != "" && config.Rewrite == "":
+		rule.target = config.Redirect
+		rule.redirect = true
+		rule.status = http.StatusFound
+		if config.Status != 0 {
+			rule.status = http.StatusCode(config.Status)
+		}
+		switch rule.status {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect,
+			http.StatusPermanentRedirect:
+		default:
+			return nil, errors.New("invalid redirect status")
+		}
+	default:
+		return nil, errors.New("rewrite rule must have exactly one of rewrite or redirect")
+	}
+	return
+}
+
+// Returns the target of the rule with capture groups from the path expanded, or false if the rule does not match.
+func (rule *rewriteRule) apply(req *http.Request) (string, bool) {
+	pathString := req.Uri.PathString()
+	match := rule.path.FindStringSubmatchIndex(pathString)
+	if match == nil {
+		return "", false
+	}
+
+	if rule.host != nil && !rule.host.MatchString(requestHost(req)) {
+		return "", false
+	}
+	for name, regex := range rule.query {
+		if value, ok := req.Uri.Query(name); !ok || !regex.MatchString(value) {
+			return "", false
+		}
+	}
+	for name, regex := range rule.headers {
+		if value, ok := req.Headers.Lookup(http.Header(name)); !ok || !regex.MatchString(value) {
+			return "", false
+		}
+	}
+
+	target := rule.expand(pathString, match)
+	if query := req.Uri.RawQuery(); query != "" && !strings.Contains(target, "?") {
+		target += "?" + query
+	}
+	return target, true
+}
+
+// Expands the capture groups in the target like regexp.Expand. Captures come from the decoded path, so they are
+// percent-encoded for the part of the target they end up in, and can neither end the path early nor add parameters
+// to the query. The rest of the target is written as given, since it is already a URI reference.
+func (rule *rewriteRule) expand(pathString string, match []int) string {
+	var builder strings.Builder
+	component := http.UriComponentPath
+	writeLiteral := func(literal string) {
+		if component == http.UriComponentPath && strings.ContainsAny(literal, "?#") {
+			component = http.UriComponentQueryParam
+		}
+		builder.WriteString(literal)
+	}
+
+	template := rule.target
+	for {
+		index := strings.Index(template, "$")
+		if index < 0 {
+			writeLiteral(template)
+			return builder.String()
+		}
+		writeLiteral(template[:index])
+		template = template[index+1:]
+
+		name, rest, ok := captureName(template)
+		switch {
+		case strings.HasPrefix(template, "$"):
+			writeLiteral("$")
+			template = template[1:]
+		case !ok:
+			writeLiteral("$")
+		default:
+			group := -1
+			if number, err := strconv.Atoi(name); err == nil {
+				group = number
+			} else {
+				for index, subexpName := range rule.path.SubexpNames() {
+					if subexpName == name {
+						group = index
+						break
+					}
+				}
+			}
+			if group >= 0 && 2*group < len(match) && match[2*group] >= 0 {
+				builder.WriteString(http.EncodePercent(pathString[match[2*group]:match[2*group+1]], component))
+			}
+			template = rest
+		}
+	}
+}
+
+// Reads a capture reference in the form `name` or `{name}` from the start of a template, after its `$`.
+func captureName(template string) (name string, rest string, ok bool) {
+	if strings.HasPrefix(template, "{") {
+		end := strings.Index(template, "}")
+		if end < 2 {
+			return "", template, false
+		}
+		return template[1:end], template[end+1:], true
+	}
+
+	end := 0
+	for end < len(template) {
+		char, size := utf8.DecodeRuneInString(template[end:])
+		if char != '_' && !unicode.IsLetter(char) && !unicode.IsDigit(char) {
+			break
+		}
+		end += size
+	}
+	return template[:end], template[end:], end > 0
+}
+
+func (engine *rewriteEngine) reload() error {
+	info, err := os.Stat(engine.file)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(engine.file)
+	if err != nil {
+		return err
+	}
+
+	var configs []RewriteRuleConfig
+	if err := json.Unmarshal(content, &configs); err != nil {
+		return err
+	}
+	rules, err := newRewriteRules(configs)
+	if err != nil {
+		return err
+	}
+
+	engine.fileRules = rules
+	engine.fileModTime = info.ModTime()
+	return nil
+}
+
+// Reloads the rule file if it has changed, checking at most once per reload interval. If the new file is invalid,
+// the previous rules are kept.
+func (engine *rewriteEngine) reloadIfChanged() {
+	if engine.file == "" {
+		return
+	}
+	// Most requests only need to see that a check is not due yet, which must not hold up the others.
+	engine.lock.RLock()
+	due := time.Since(engine.lastCheck) >= util.DefaultRewriteReloadInterval
+	engine.lock.RUnlock()
+	if !due {
+		return
+	}
+
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	if time.Since(engine.lastCheck) < util.DefaultRewriteReloadInterval {
+		return
+	}
+	engine.lastCheck = time.Now()
+
+	if info, err := os.Stat(engine.file); err == nil && !info.ModTime().Equal(engine.fileModTime) {
+		if err := engine.reload(); err != nil {
+			log.Println("An issue occurred while reloading the rewrite rule file.")
+			engine.fileModTime = info.ModTime()
+		}
+	}
+}
+
+func (engine *rewriteEngine) match(req *http.Request) (*rewriteRule, string) {
+	engine.lock.RLock()
+	defer engine.lock.RUnlock()
+
+	for _, rules := range [][]*rewriteRule{engine.rules, engine.fileRules} {
+		for _, rule := range rules {
+			if target, ok := rule.apply(req); ok {
+				return rule, target
+			}
+		}
+	}
+	return nil, ""
+}
+
+// Applies rewrite rules until none match or a redirect is sent, updating the request target for internal rewrites.
+// Returns false if a response was already sent.
+func (server *FileServer) applyRewriteRules(req *http.Request, writer *bufio.Writer) bool {
+	if server.rewriteEngine == nil {
+		return true
+	}
+	server.rewriteEngine.reloadIfChanged()
+
+	seen := map[string]bool{req.Uri.String(): true}
+	for iteration := 0; ; iteration++ {
+		rule, target := server.rewriteEngine.match(req)
+		if rule == nil {
+			return true
+		}
+
+		if containsControl(target) {
+			log.Println("A rewrite rule produced an invalid target: " + strconv.Quote(target))
+			server.respondErrorTemplate(writer, req, http.StatusInternalServerError, false)
+			return false
+		}
+		if rule.redirect {
+			server.newResponse(req).WithStatus(rule.status).WithHeader(http.HeaderLocation, target).Respond(writer)
+			return false
+		}
+
+		uri, err := http.ParseUri(req.Method, target)
+		if err != nil || uri.Form() != http.FormOrigin {
+			log.Println("A rewrite rule produced an invalid target: " + target)
+			server.respondErrorTemplate(writer, req, http.StatusInternalServerError, false)
+			return false
+		}
+
+		// A rule that rewrites to itself is treated as final rather than as a loop.
+		if uri.String() == req.Uri.String() {
+			return true
+		}
+		if seen[uri.String()] || iteration >= util.RewriteMaxIterations {
+			log.Println("A rewrite loop was detected for " + req.Uri.String())
+			server.respondErrorTemplate(writer, req, http.StatusInternalServerError, false)
+			return false
+		}
+		seen[uri.String()] = true
+		req.Uri = uri
+	}
+}
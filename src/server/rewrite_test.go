@@ -0,0 +1,91 @@
+package server_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"segaline/src/http"
+	"segaline/src/segalinetest"
+	"segaline/src/server"
+	"testing"
+)
+
+func TestRewriteRedirectsEncodeCaptures(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteFile("new/a?b.txt", "question")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		RewriteRules: []server.RewriteRuleConfig{
+			{Path: "^/q/([^/]+)$", Redirect: "/search?q=$1"},
+			{Path: "^/named/(?P<page>[^/]+)$", Redirect: "/pages/${page}.html?from=$$"},
+			{Path: "^/old/([^/]+)$", Redirect: "/new/$1"},
+			{Path: "^/moved/([^/]+)$", Rewrite: "/new/$1"},
+			{Path: "^/encoded$", Redirect: "/a%20b"},
+			{Path: "^/fragment/([^/]+)$", Redirect: "/x#$1"},
+		},
+	})
+
+	cases := []struct {
+		target   string
+		location string
+	}{
+		{"/q/a%26b=c", "/search?q=a%26b%3Dc"},
+		{"/q/a%20b", "/search?q=a%20b"},
+		{"/named/intro", "/pages/intro.html?from=$"},
+		{"/old/a%3Fb%23c", "/new/a%3Fb%23c"},
+		{"/old/x?keep=1", "/new/x?keep=1"},
+		{"/encoded", "/a%20b"},
+		{"/fragment/a%20b", "/x#a%20b"},
+	}
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			testServer.Do(segalinetest.Get(c.target)).
+				AssertStatus(http.StatusFound).
+				AssertHeader(http.HeaderLocation, c.location).
+				AssertBody("")
+		})
+	}
+
+	testServer.Do(segalinetest.Get("/q/a%0d%0aSet-Cookie:%20x=1")).AssertNoHeader(http.HeaderSetCookie)
+	testServer.Do(segalinetest.Get("/moved/a%3Fb.txt")).AssertStatus(http.StatusOK).AssertBody("question")
+	testServer.Do(segalinetest.NewRequest(http.MethodTrace, "/moved/a%3Fb.txt")).
+		AssertStatus(http.StatusOK).
+		AssertBodyContains("TRACE /moved/a%3Fb.txt HTTP/1.1")
+}
+
+func TestRewriteKeepsOriginalTargetForDigest(t *testing.T) {
+	ha1 := sha256.Sum256([]byte("alice:files:secret"))
+	fixture := segalinetest.NewFixture(t).
+		WriteFile("private/page.txt", "page").
+		WriteTemplate("users", "alice:files:"+hex.EncodeToString(ha1[:]))
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		RewriteRules: []server.RewriteRuleConfig{{Path: "^/alias$", Rewrite: "/private/page.txt"}},
+		Auth: []server.AuthConfig{{
+			PathPrefix: "/private",
+			Realm:      "files",
+			Scheme:     "digest",
+			UserFile:   filepath.Join(fixture.TemplateRoot, "users"),
+		}},
+	})
+
+	challenge := testServer.Do(segalinetest.Get("/alias")).
+		AssertStatus(http.StatusUnauthorized).
+		Header(http.HeaderWWWAuthenticate)
+	nonce := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(challenge)
+	if nonce == nil {
+		t.Fatalf("expected a nonce in %q", challenge)
+	}
+
+	ha2 := sha256.Sum256([]byte("GET:/alias"))
+	response := sha256.Sum256([]byte(hex.EncodeToString(ha1[:]) + ":" + nonce[1] + ":00000001:abc:auth:" +
+		hex.EncodeToString(ha2[:])))
+	authorization := fmt.Sprintf(
+		`Digest username="alice", realm="files", nonce="%s", uri="/alias", qop=auth, nc=00000001, `+
+			`cnonce="abc", algorithm=SHA-256, response="%s"`,
+		nonce[1],
+		hex.EncodeToString(response[:]),
+	)
+	testServer.Do(segalinetest.Get("/alias").WithHeader(http.HeaderAuthorization, authorization)).
+		AssertStatus(http.StatusOK).
+		AssertBody("page")
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"path"
+	"segaline/src/http"
+	"segaline/src/util"
+	"sort"
+	"strings"
+)
+
+type securityPolicy struct {
+	pathPrefix string
+	extensions []string
+	headers    map[http.Header]string
+}
+
+// Policies without a path prefix or extensions apply globally. When several policies match, more specific ones
+// (global, then by prefix length, then by extension) override less specific ones header by header, and a value of
+// `-` removes a header set by a less specific policy (including the default `Server` banner).
+func newSecurityPolicy(config SecurityHeadersConfig) *securityPolicy {
+	policy := &securityPolicy{
+		pathPrefix: strings.TrimSuffix(config.PathPrefix, "/"),
+		headers:    map[http.Header]string{},
+	}
+	for _, ext := range config.Extensions {
+		policy.extensions = append(policy.extensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+
+	for header, value := range map[http.Header]string{
+		http.HeaderStrictTransportSecurity: config.StrictTransportSecurity,
+		http.HeaderContentSecurityPolicy:   config.ContentSecurityPolicy,
+		http.HeaderXContentTypeOptions:     config.ContentTypeOptions,
+		http.HeaderReferrerPolicy:          config.ReferrerPolicy,
+		http.HeaderPermissionsPolicy:       config.PermissionsPolicy,
+		http.HeaderXFrameOptions:           config.FrameOptions,
+		http.HeaderServer:                  config.Server,
+	} {
+		if value != "" {
+			policy.headers[header] = value
+		}
+	}
+	return policy
+}
+
+func (policy *securityPolicy) matches(pathString string) bool {
+	if len(policy.extensions) == 0 {
+		return hasPathPrefix(pathString, policy.pathPrefix)
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(pathString), "."))
+	for _, policyExt := range policy.extensions {
+		if policyExt == ext {
+			return hasPathPrefix(pathString, policy.pathPrefix)
+		}
+	}
+	return false
+}
+
+func (policy *securityPolicy) specificity() int {
+	if len(policy.extensions) > 0 {
+		return util.RequestMaxURILength + len(policy.pathPrefix)
+	}
+	return len(policy.pathPrefix)
+}
+
+func (server *FileServer) securityHeadersFor(pathString string) map[http.Header]string {
+	var matches []*securityPolicy
+	for _, policy := range server.securityPolicies {
+		if policy.matches(pathString) {
+			matches = append(matches, policy)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].specificity() < matches[j].specificity() })
+
+	headers := map[http.Header]string{}
+	for _, policy := range matches {
+		for header, value := range policy.headers {
+			headers[header] = value
+		}
+	}
+	return headers
+}
+
+// Adds the security headers for a request to a response, returning the nonce substituted into the content security
+// policy, if the policy contains the nonce placeholder.
+func (server *FileServer) applySecurityHeaders(req *http.Request, res *http.Response, pathString string) (nonce string) {
+	for header, value := range server.securityHeadersFor(pathString) {
+		switch {
+		case value == "-":
+			res.WithoutHeader(header)
+		case header == http.HeaderStrictTransportSecurity && req.TLS == nil:
+			// Browsers ignore HSTS over plain HTTP, and it should not be sent there.
+		case header == http.HeaderContentSecurityPolicy && strings.Contains(value, util.CSPNoncePlaceholder):
+			if nonce == "" {
+				nonce = newCSPNonce()
+			}
+			res.WithHeader(header, strings.ReplaceAll(value, util.CSPNoncePlaceholder, nonce))
+		default:
+			res.WithHeader(header, value)
+		}
+	}
+	return
+}
+
+func newCSPNonce() string {
+	nonce := make([]byte, 18)
+	_, _ = rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(nonce)
+}
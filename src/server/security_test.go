@@ -0,0 +1,21 @@
+package server_test
+
+import (
+	"segaline/src/http"
+	"segaline/src/segalinetest"
+	"segaline/src/server"
+	"testing"
+)
+
+func TestSecurityHeadersFollowServedFile(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).WriteFile("index.html", "home").WriteFile("data.json", "{}")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		SecurityHeaders: []server.SecurityHeadersConfig{{Extensions: []string{"html"}, ContentSecurityPolicy: "default-src 'self'"}},
+	})
+
+	testServer.Do(segalinetest.Get("/")).AssertHeader(http.HeaderContentSecurityPolicy, "default-src 'self'")
+	testServer.Do(segalinetest.Get("/missing.html")).
+		AssertStatus(http.StatusNotFound).
+		AssertHeader(http.HeaderContentSecurityPolicy, "default-src 'self'")
+	testServer.Do(segalinetest.Get("/data.json")).AssertNoHeader(http.HeaderContentSecurityPolicy)
+}
@@ -1,6 +1,11 @@
 package server
 
+import "net"
+
 type Server interface {
 	Start(addr string) error
+	StartTLS(addr string, config TLSConfig) error
+	Serve(listener net.Listener) error
+	ServeConn(conn net.Conn)
 	Stop() error
 }
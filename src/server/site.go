@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"os"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+)
+
+type site struct {
+	hosts          []string
+	fileRoot       string
+	templateRoot   string
+	indexDocuments []string
+	errorPages     map[http.StatusCode]string
+}
+
+func newDefaultSite(fileRoot string, templateRoot string) *site {
+	return &site{
+		fileRoot:       strings.TrimSuffix(fileRoot, "/"),
+		templateRoot:   strings.TrimSuffix(templateRoot, "/"),
+		indexDocuments: []string{strings.TrimPrefix(util.DefaultEmptyRequestTarget, "/")},
+		errorPages:     map[http.StatusCode]string{},
+	}
+}
+
+// Sites without their own file root, template root or index documents inherit those of the default site.
+func newSite(config SiteConfig, defaultSite *site) (*site, error) {
+	site := &site{
+		fileRoot:       strings.TrimSuffix(config.FileRoot, "/"),
+		templateRoot:   strings.TrimSuffix(config.TemplateRoot, "/"),
+		indexDocuments: config.IndexDocuments,
+		errorPages:     map[http.StatusCode]string{},
+	}
+	for _, host := range config.Hosts {
+		site.hosts = append(site.hosts, strings.ToLower(host))
+	}
+
+	if config.FileRoot == "" {
+		site.fileRoot = defaultSite.fileRoot
+	}
+	if config.TemplateRoot == "" {
+		site.templateRoot = defaultSite.templateRoot
+	}
+	if len(site.indexDocuments) == 0 {
+		site.indexDocuments = defaultSite.indexDocuments
+	}
+	for status, page := range config.ErrorPages {
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return nil, err
+		}
+		site.errorPages[http.StatusCode(code)] = page
+	}
+	return site, nil
+}
+
+func (site *site) matchesHost(host string, wildcard bool) bool {
+	for _, pattern := range site.hosts {
+		if !wildcard && pattern == host || wildcard && strings.Contains(pattern, "*") && matchGlob(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolves a request path to a file under the site's file root, trying each index document for directories.
+func (site *site) resolvePath(pathString string) (string, string) {
+	if info, err := os.Stat(site.fileRoot + pathString); pathString != "/" && (err != nil || !info.IsDir()) {
+		return pathString, site.fileRoot + pathString
+	}
+
+	base := strings.TrimSuffix(pathString, "/") + "/"
+	for _, index := range site.indexDocuments {
+		if fileExists(site.fileRoot + base + index) {
+			return base + index, site.fileRoot + base + index
+		}
+	}
+	return base + site.indexDocuments[0], site.fileRoot + base + site.indexDocuments[0]
+}
+
+// Selects the site for a request by the host in the request target or `Host` header, preferring exact host names
+// over wildcard patterns. Returns false if no site matches and the default site may not be used.
+func (server *FileServer) siteFor(req *http.Request) (*site, bool) {
+	host := requestHost(req)
+	if host != "" {
+		for _, wildcard := range []bool{false, true} {
+			for _, site := range server.sites {
+				if site.matchesHost(host, wildcard) {
+					return site, true
+				}
+			}
+		}
+	}
+
+	// On TLS listeners, serving the default site for an unknown host would present the wrong certificate's content.
+	if req.TLS != nil && len(server.sites) > 0 {
+		return server.defaultSite, false
+	}
+	return server.defaultSite, true
+}
+
+// Responds with 421 if the request cannot be served by any site on this connection, either because the host matches
+// no site on a TLS listener, or because it selects a different site than the TLS server name did.
+func (server *FileServer) checkSite(req *http.Request, writer *bufio.Writer) bool {
+	site, ok := server.siteFor(req)
+	if ok && req.TLS != nil && req.TLS.ServerName != "" {
+		sniRequest := http.Request{}
+		sniRequest.Headers.Set(http.HeaderHost, req.TLS.ServerName)
+		sniSite, sniOk := server.siteFor(&sniRequest)
+		ok = sniOk && sniSite == site
+	}
+
+	if !ok {
+		server.respondErrorTemplate(writer, req, http.StatusMisdirectedRequest, false)
+	}
+	return ok
+}
+
+func requestHost(req *http.Request) string {
+	host := req.Uri.Host()
+	if host == "" {
+		host = req.Headers.Get(http.HeaderHost)
+		if colon := strings.LastIndex(host, ":"); colon >= 0 && !strings.HasSuffix(host, "]") {
+			host = host[:colon]
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"path"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strings"
+)
+
+type spaPolicy struct {
+	pathPrefix   string
+	fallback     string
+	cacheControl string
+}
+
+func newSPAPolicy(config SPAConfig) *spaPolicy {
+	policy := &spaPolicy{
+		pathPrefix:   strings.TrimSuffix(config.PathPrefix, "/"),
+		fallback:     "/" + strings.TrimPrefix(config.Fallback, "/"),
+		cacheControl: config.CacheControl,
+	}
+	if policy.cacheControl == "" {
+		policy.cacheControl = util.DefaultSPACacheControl
+	}
+	return policy
+}
+
+// Returns the SPA policy whose fallback document should be served instead of a 404 for a request, if the request
+// looks like a client-side route navigation rather than a request for a missing asset.
+func (server *FileServer) spaPolicyFor(req *http.Request) *spaPolicy {
+	pathString := req.Uri.PathString()
+	if path.Ext(pathString) != "" || !acceptsMediaType(req, http.MediaTypeHTML) {
+		return nil
+	}
+
+	var match *spaPolicy
+	for _, policy := range server.spaPolicies {
+		if hasPathPrefix(pathString, policy.pathPrefix) && (match == nil || len(policy.pathPrefix) > len(match.pathPrefix)) {
+			match = policy
+		}
+	}
+	return match
+}
+
+// Checks whether the `Accept` header explicitly lists a media type with a nonzero quality value.
+func acceptsMediaType(req *http.Request, mediaType http.MediaType) bool {
+	for _, mediaRange := range strings.Split(req.Headers.Get(http.HeaderAccept), ",") {
+		params := strings.Split(mediaRange, ";")
+		if !strings.EqualFold(strings.Trim(params[0], util.RequestOWS), string(mediaType)) {
+			continue
+		}
+
+		accepted := true
+		for _, param := range params[1:] {
+			param = strings.Trim(param, util.RequestOWS)
+			if strings.HasPrefix(param, "q=") {
+				accepted = strings.Trim(param[2:], "0.") != ""
+			}
+		}
+		return accepted
+	}
+	return false
+}
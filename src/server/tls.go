@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"path"
+	"segaline/src/http"
+	"strings"
+)
+
+type clientCertRule struct {
+	pathPrefix string
+	subjects   []string
+	sans       []string
+}
+
+func newTLSConfig(config TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	switch strings.ToLower(config.ClientAuth) {
+	case "", "off":
+		tlsConfig.ClientAuth = tls.NoClientCert
+		return tlsConfig, nil
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.New("unsupported client auth mode: " + config.ClientAuth)
+	}
+
+	bundle, err := ioutil.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(bundle) {
+		return nil, errors.New("no certificates in client ca bundle")
+	}
+	return tlsConfig, nil
+}
+
+func newClientCertRule(config ClientCertConfig) clientCertRule {
+	return clientCertRule{
+		pathPrefix: strings.TrimSuffix(config.PathPrefix, "/"),
+		subjects:   config.Subjects,
+		sans:       config.SANs,
+	}
+}
+
+// Rules without any subject or SAN patterns accept any verified certificate.
+func (rule *clientCertRule) matches(cert *x509.Certificate) bool {
+	if len(rule.subjects) == 0 && len(rule.sans) == 0 {
+		return true
+	}
+
+	for _, pattern := range rule.subjects {
+		if matchGlob(pattern, cert.Subject.String()) || matchGlob(pattern, cert.Subject.CommonName) {
+			return true
+		}
+	}
+	for _, pattern := range rule.sans {
+		for _, san := range certificateSANs(cert) {
+			if matchGlob(pattern, san) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Responds with 403 if a client certificate rule applies to the request and no matching verified certificate was
+// presented, since the client cannot be challenged for one after the handshake.
+func (server *FileServer) checkClientCert(req *http.Request, writer *bufio.Writer) bool {
+	if !server.clientCertAllows(req, req.Uri.PathString()) {
+		server.respondErrorTemplate(writer, req, http.StatusForbidden, false)
+		return false
+	}
+	return true
+}
+
+// Checks whether the certificate the request was made with satisfies every client certificate rule for a path.
+func (server *FileServer) clientCertAllows(req *http.Request, pathString string) bool {
+	for _, rule := range server.clientCertRules {
+		if !hasPathPrefix(pathString, rule.pathPrefix) {
+			continue
+		}
+		if req.ClientCertificate == nil || !rule.matches(req.ClientCertificate) {
+			return false
+		}
+	}
+	return true
+}
+
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+func matchGlob(pattern string, str string) bool {
+	matched, err := path.Match(pattern, str)
+	return err == nil && matched
+}
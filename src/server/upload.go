@@ -0,0 +1,343 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strings"
+	"unicode/utf8"
+)
+
+type uploadPolicy struct {
+	pathPrefix   string
+	maxFileSize  int64
+	maxTotalSize int64
+	allowedTypes []string
+}
+
+type uploadedFile struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+
+	tempPath string
+	filePath string
+}
+
+func newUploadPolicy(config UploadConfig) *uploadPolicy {
+	policy := &uploadPolicy{
+		pathPrefix:   strings.TrimSuffix(config.PathPrefix, "/"),
+		maxFileSize:  config.MaxFileSize,
+		maxTotalSize: config.MaxTotalSize,
+		allowedTypes: config.AllowedTypes,
+	}
+	if policy.maxFileSize <= 0 {
+		policy.maxFileSize = util.DefaultUploadMaxFileSize
+	}
+	if policy.maxTotalSize <= 0 {
+		policy.maxTotalSize = util.DefaultUploadMaxTotalSize
+	}
+	return policy
+}
+
+func (server *FileServer) uploadPolicyFor(pathString string) *uploadPolicy {
+	var match *uploadPolicy
+	for _, policy := range server.uploadPolicies {
+		if hasPathPrefix(pathString, policy.pathPrefix) && (match == nil || len(policy.pathPrefix) > len(match.pathPrefix)) {
+			match = policy
+		}
+	}
+	return match
+}
+
+// Both the declared media type of an upload and the type it will be served as, which follows from its extension,
+// have to be allowed. Without a list of allowed types, anything is accepted.
+func (policy *uploadPolicy) allowsType(declared string, served http.MediaType) bool {
+	if len(policy.allowedTypes) == 0 {
+		return true
+	}
+	if declared != "" {
+		mediaType, _, err := mime.ParseMediaType(declared)
+		if err != nil || !matchesMediaType(policy.allowedTypes, http.MediaType(mediaType)) {
+			return false
+		}
+	}
+	return matchesMediaType(policy.allowedTypes, served)
+}
+
+// Replaces or creates a file with the request body. The body is written to a temporary file first, which is then
+// renamed over the target so that readers never see a partially written file.
+func (server *FileServer) handlePutRequest(req *http.Request, writer *bufio.Writer) bool {
+	pathString := req.Uri.PathString()
+	policy := server.uploadPolicyFor(pathString)
+	if policy == nil {
+		server.respondErrorTemplate(writer, req, http.StatusMethodNotAllowed, false)
+		return req.WillCloseConnection()
+	}
+
+	site, _ := server.siteFor(req)
+	name := path.Base(pathString)
+	filePath := site.fileRoot + pathString
+	if strings.HasSuffix(pathString, "/") || sanitizeFileName(name) != name {
+		server.respondErrorTemplate(writer, req, http.StatusBadRequest, false)
+		return req.WillCloseConnection()
+	}
+	if info, err := os.Stat(filepath.Dir(filePath)); err != nil || !info.IsDir() || isDirectory(filePath) {
+		server.respondErrorTemplate(writer, req, http.StatusConflict, false)
+		return req.WillCloseConnection()
+	}
+	if !policy.allowsType(req.Headers.Get(http.HeaderContentType), server.contentTypeByExt(uploadExt(name))) {
+		server.respondErrorTemplate(writer, req, http.StatusUnsupportedMediaType, false)
+		return req.WillCloseConnection()
+	}
+	if !server.checkWebDAVLocks(req, writer, false, filePath) ||
+		(!fileExists(filePath) && !server.checkWebDAVLocks(req, writer, false, filepath.Dir(filePath))) {
+		return req.WillCloseConnection()
+	}
+
+	// Preconditions are checked before the body is read. Just before the file is replaced, it only has to be the same
+	// file that was checked, which its modification time and size show without hashing it again.
+	result, checked := server.uploadPreconditions(req, filePath)
+	if result != ConditionalHeadersPassed {
+		server.respondErrorTemplate(writer, req, http.StatusPreconditionFailed, false)
+		return req.WillCloseConnection()
+	}
+
+	upload := &uploadedFile{Name: name, Path: pathString, filePath: filePath}
+	if status := server.stageUpload(upload, req.Body, policy.maxFileSize); status != http.StatusOK {
+		server.respondErrorTemplate(writer, req, status, status == http.StatusEntityTooLarge)
+		return req.WillCloseConnection()
+	}
+
+	server.uploadLock.Lock()
+	current, err := os.Stat(filePath)
+	existed := err == nil
+	unchanged := existed == (checked != nil) &&
+		(checked == nil || checked.modTime.Equal(current.ModTime()) && checked.size == current.Size())
+	passed := unchanged || !req.Headers.Has(http.HeaderIfMatch) && !req.Headers.Has(http.HeaderIfNoneMatch)
+	status := http.StatusPreconditionFailed
+	if passed && !server.commitUploads([]*uploadedFile{upload}, true) {
+		status = http.StatusInternalServerError
+	} else if passed {
+		status = http.StatusCreated
+		if existed {
+			status = http.StatusNoContent
+		}
+	}
+	server.uploadLock.Unlock()
+
+	if status != http.StatusCreated && status != http.StatusNoContent {
+		_ = os.Remove(upload.tempPath)
+		server.respondErrorTemplate(writer, req, status, false)
+		return req.WillCloseConnection()
+	}
+
+	res := server.newResponse(req).WithStatus(status)
+	if file, err := server.fileCache.get(filePath); err == nil {
+		res.WithHeader(http.HeaderETag, "\""+file.eTag+"\"")
+	}
+	res.Respond(writer)
+	return req.WillCloseConnection()
+}
+
+// Stores every file part of a `multipart/form-data` body in the target directory. Parts are streamed to temporary
+// files, which are only moved into place once the whole body has been read and checked, so that a failed upload
+// leaves no files behind. Existing files are never replaced.
+func (server *FileServer) handlePostRequest(req *http.Request, writer *bufio.Writer) bool {
+	pathString := req.Uri.PathString()
+	policy := server.uploadPolicyFor(pathString)
+	if policy == nil {
+		server.respondErrorTemplate(writer, req, http.StatusMethodNotAllowed, false)
+		return req.WillCloseConnection()
+	}
+
+	mediaType, params, err := mime.ParseMediaType(req.Headers.Get(http.HeaderContentType))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		server.respondErrorTemplate(writer, req, http.StatusUnsupportedMediaType, false)
+		return req.WillCloseConnection()
+	}
+
+	site, _ := server.siteFor(req)
+	dirPath := strings.TrimSuffix(site.fileRoot+pathString, "/")
+	if !isDirectory(dirPath) {
+		server.respondErrorTemplate(writer, req, http.StatusConflict, false)
+		return req.WillCloseConnection()
+	}
+	// New members are added to the directory, so a lock on it has to be submitted, as for PUT.
+	if !server.checkWebDAVLocks(req, writer, false, dirPath) {
+		return req.WillCloseConnection()
+	}
+
+	uploads, status := server.stageMultipart(req, policy, dirPath, strings.TrimSuffix(pathString, "/"))
+	if status == http.StatusOK {
+		server.uploadLock.Lock()
+		if !server.commitUploads(uploads, false) {
+			status = http.StatusConflict
+		}
+		server.uploadLock.Unlock()
+	}
+	if status != http.StatusOK {
+		for _, upload := range uploads {
+			_ = os.Remove(upload.tempPath)
+		}
+		server.respondErrorTemplate(writer, req, status, status == http.StatusEntityTooLarge)
+		return req.WillCloseConnection()
+	}
+
+	content, _ := json.Marshal(map[string]interface{}{"files": uploads})
+	server.newResponse(req).WithStatus(http.StatusCreated).WithBody(content, http.MediaTypeJSON).Respond(writer)
+	return req.WillCloseConnection()
+}
+
+func (server *FileServer) stageMultipart(
+	req *http.Request,
+	policy *uploadPolicy,
+	dirPath string,
+	dirPathString string,
+) (uploads []*uploadedFile, status http.StatusCode) {
+	_, params, _ := mime.ParseMediaType(req.Headers.Get(http.HeaderContentType))
+	reader := multipart.NewReader(req.Body, params["boundary"])
+	names := map[string]bool{}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return uploads, uploadReadStatus(err)
+		}
+		if part.FormName() == "" || part.FileName() == "" {
+			continue
+		}
+
+		name := sanitizeFileName(part.FileName())
+		if name == "" || names[name] {
+			return uploads, http.StatusBadRequest
+		}
+		names[name] = true
+		if !policy.allowsType(part.Header.Get(string(http.HeaderContentType)), server.contentTypeByExt(uploadExt(name))) {
+			return uploads, http.StatusUnsupportedMediaType
+		}
+
+		upload := &uploadedFile{Name: name, Path: dirPathString + "/" + name, filePath: dirPath + "/" + name}
+		if status := server.stageUpload(upload, part, policy.maxFileSize); status != http.StatusOK {
+			return uploads, status
+		}
+		uploads = append(uploads, upload)
+	}
+
+	if len(uploads) == 0 {
+		return uploads, http.StatusBadRequest
+	}
+	return uploads, http.StatusOK
+}
+
+// Writes an upload to a temporary file next to its target, returning the status to respond with if that fails.
+func (server *FileServer) stageUpload(upload *uploadedFile, reader io.Reader, maxSize int64) http.StatusCode {
+	temp, err := ioutil.TempFile(filepath.Dir(upload.filePath), ".upload-*")
+	if err != nil {
+		log.Println("An issue occurred while creating a file for an upload.")
+		return http.StatusInternalServerError
+	}
+	upload.tempPath = temp.Name()
+
+	upload.Size, err = io.Copy(temp, io.LimitReader(reader, maxSize+1))
+	if closeErr := temp.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err == nil && upload.Size > maxSize {
+		err = errors.New(util.ErrorContentLengthExceeded)
+	}
+	if err == nil {
+		err = os.Chmod(upload.tempPath, 0644)
+	}
+	if err != nil {
+		_ = os.Remove(upload.tempPath)
+		return uploadReadStatus(err)
+	}
+	return http.StatusOK
+}
+
+// Moves staged uploads into place, failing without moving any of them if one would replace an existing file and
+// replacing is not allowed. If a file cannot be moved, the ones moved before it are removed again, which is only
+// safe because they replaced nothing. This must be called with the upload lock held.
+func (server *FileServer) commitUploads(uploads []*uploadedFile, replace bool) bool {
+	for _, upload := range uploads {
+		if !replace && fileExists(upload.filePath) {
+			return false
+		}
+	}
+	for index, upload := range uploads {
+		if err := os.Rename(upload.tempPath, upload.filePath); err != nil {
+			log.Println("An issue occurred while storing an upload.")
+			for _, committed := range uploads[:index] {
+				_ = os.Remove(committed.filePath)
+				server.fileCache.invalidate(committed.filePath)
+			}
+			return false
+		}
+		server.fileCache.invalidate(upload.filePath)
+	}
+	return true
+}
+
+// Evaluates the ETag preconditions of an upload, returning the file they were evaluated against, if it exists.
+func (server *FileServer) uploadPreconditions(req *http.Request, filePath string) (ConditionalHeaderResult, *cachedFile) {
+	file, err := server.fileCache.get(filePath)
+	if err != nil {
+		return server.eTagConditionalsPassed(req, ""), nil
+	}
+	return server.eTagConditionalsPassed(req, "\""+file.eTag+"\""), file
+}
+
+func uploadReadStatus(err error) http.StatusCode {
+	switch err.Error() {
+	case util.ErrorContentLengthExceeded:
+		return http.StatusEntityTooLarge
+	case util.ErrorTimeoutReached:
+		return http.StatusRequestTimeout
+	}
+	if _, ok := err.(*os.PathError); ok {
+		log.Println("An issue occurred while writing an upload.")
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+func uploadExt(name string) string {
+	return strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+}
+
+// Reduces an uploaded file name to a plain base name, rejecting names that are empty, hidden or not valid UTF-8.
+// Characters that are special on common file systems are removed.
+func sanitizeFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(char rune) rune {
+		if char < 0x20 || char == 0x7F || strings.ContainsRune(`/<>:"|?*`, char) {
+			return -1
+		}
+		return char
+	}, name)
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+
+	if name == "" || strings.HasPrefix(name, ".") || len(name) > 255 || !utf8.ValidString(name) {
+		return ""
+	}
+	return name
+}
+
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
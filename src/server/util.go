@@ -3,6 +3,10 @@ package server
 import (
 	"crypto/sha1"
 	"encoding/base32"
+	"encoding/binary"
+	"os"
+	"segaline/src/http"
+	"segaline/src/util"
 	"strings"
 	"time"
 )
@@ -16,9 +20,48 @@ const (
 )
 
 func getETag(content []byte) string {
-	sha := sha1.New()
-	sha.Write(content)
-	return strings.ToLower(base32.HexEncoding.EncodeToString(sha.Sum(nil)))
+	sum := sha1.Sum(content)
+	return formatETag(sum[:])
+}
+
+func formatETag(sum []byte) string {
+	return strings.ToLower(base32.HexEncoding.EncodeToString(sum))
+}
+
+// Derives an ETag from a file's modification time and size, for files that are too large to hash on every change.
+func getFileInfoETag(info os.FileInfo) string {
+	sum := make([]byte, 16)
+	binary.BigEndian.PutUint64(sum, uint64(info.ModTime().UnixNano()))
+	binary.BigEndian.PutUint64(sum[8:], uint64(info.Size()))
+	return formatETag(sum)
+}
+
+// Checks whether a list of entity tags contains one, using the weak comparison of RFC 9110 if requested, and the
+// strong comparison (where weak tags never match) otherwise.
+func containsETag(list string, eTag string, weak bool) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.Trim(tag, util.RequestOWS)
+		if weak && strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(eTag, "W/") {
+			return true
+		}
+		if !weak && tag == eTag && !strings.HasPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether a media type matches any of a list of patterns, which may end in `/*` to match a whole type.
+func matchesMediaType(patterns []string, mediaType http.MediaType) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(string(mediaType), strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+		if strings.EqualFold(pattern, string(mediaType)) {
+			return true
+		}
+	}
+	return false
 }
 
 func formatTimeGMT(t time.Time) string {
@@ -28,3 +71,49 @@ func formatTimeGMT(t time.Time) string {
 func parseTimeGMT(t string) (time.Time, error) {
 	return time.Parse(time.RFC1123[:len(time.RFC1123)-3]+"GMT", t)
 }
+
+func hasPathPrefix(path string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return strings.HasPrefix(path, prefix) && (len(path) == len(prefix) || path[len(prefix)] == '/')
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// Checks for control characters, which may not appear in a request target or header value.
+func containsControl(str string) bool {
+	for index := 0; index < len(str); index++ {
+		if str[index] < 0x20 || str[index] == 0x7F {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMethod(methods []http.Method, method http.Method) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func formatMethods(methods []http.Method) string {
+	names := make([]string, len(methods))
+	for index, method := range methods {
+		names[index] = string(method)
+	}
+	return strings.Join(names, ", ")
+}
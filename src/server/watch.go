@@ -0,0 +1,45 @@
+package server
+
+import (
+	"log"
+	"path/filepath"
+	"segaline/src/watch"
+)
+
+// Starts watching the file and template roots of every site, so that cached files and templates are invalidated as
+// soon as they change. Other parts of the server can subscribe to the same events.
+func (server *FileServer) watchRoots() {
+	var roots []string
+	seen := map[string]bool{}
+	for _, site := range append([]*site{server.defaultSite}, server.sites...) {
+		for _, root := range []string{site.fileRoot, site.templateRoot} {
+			if root = filepath.Clean(root); !seen[root] {
+				roots = append(roots, root)
+				seen[root] = true
+			}
+		}
+	}
+
+	watcher, err := watch.NewWatcher(roots)
+	if err != nil {
+		log.Println("An issue occurred while watching the file and template roots.")
+		return
+	}
+	server.watcher = watcher
+	watcher.Subscribe(server.handleFileEvent)
+	if server.liveReload != nil {
+		watcher.Subscribe(server.handleLiveReloadEvent)
+	}
+}
+
+func (server *FileServer) handleFileEvent(event watch.Event) {
+	if event.IsDir || event.Kind == watch.EventOverflowed {
+		server.fileCache.invalidateAll()
+		server.templates.invalidateAll()
+		server.directoryListings.invalidateAll()
+	} else {
+		server.fileCache.invalidate(event.Path)
+		server.templates.invalidate(event.Path)
+		server.directoryListings.invalidate(filepath.Dir(event.Path))
+	}
+}
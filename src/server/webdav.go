@@ -0,0 +1,705 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type webDAVPolicy struct {
+	pathPrefix     string
+	maxLockTimeout time.Duration
+}
+
+var webDAVMethods = []http.Method{
+	http.MethodDelete,
+	http.MethodPropfind,
+	http.MethodProppatch,
+	http.MethodMkcol,
+	http.MethodCopy,
+	http.MethodMove,
+	http.MethodLock,
+	http.MethodUnlock,
+}
+
+var webDAVLiveProperties = []string{
+	"displayname",
+	"getcontentlength",
+	"getcontenttype",
+	"getetag",
+	"getlastmodified",
+	"lockdiscovery",
+	"resourcetype",
+	"supportedlock",
+}
+
+func newWebDAVPolicy(config WebDAVConfig) *webDAVPolicy {
+	policy := &webDAVPolicy{
+		pathPrefix:     strings.TrimSuffix(config.PathPrefix, "/"),
+		maxLockTimeout: time.Duration(config.MaxLockTimeout) * time.Second,
+	}
+	if policy.maxLockTimeout <= 0 {
+		policy.maxLockTimeout = util.DefaultWebDAVMaxLockTimeout
+	}
+	return policy
+}
+
+func (server *FileServer) webDAVPolicyFor(pathString string) *webDAVPolicy {
+	var match *webDAVPolicy
+	for _, policy := range server.webDAVPolicies {
+		if hasPathPrefix(pathString, policy.pathPrefix) && (match == nil || len(policy.pathPrefix) > len(match.pathPrefix)) {
+			match = policy
+		}
+	}
+	return match
+}
+
+// Returns the path of the requested resource without a trailing slash, and where it is stored.
+func (server *FileServer) webDAVPaths(req *http.Request) (pathString string, filePath string) {
+	site, _ := server.siteFor(req)
+	pathString = strings.TrimSuffix(req.Uri.PathString(), "/")
+	return pathString, site.fileRoot + pathString
+}
+
+// Responds with `423 Locked` unless the request submits the token of every lock on the given paths, including locks
+// on their descendants if deep is set.
+func (server *FileServer) checkWebDAVLocks(req *http.Request, writer *bufio.Writer, deep bool, filePaths ...string) bool {
+	tokens := submittedLockTokens(req)
+	for _, filePath := range filePaths {
+		if !server.webDAVLocks.allows(filePath, deep, tokens) {
+			server.respondErrorTemplate(writer, req, http.StatusLocked, false)
+			return false
+		}
+	}
+	return true
+}
+
+// Checks whether the request may also reach a path other than its target. The client cannot be challenged for that
+// path, so the credentials and certificate the request was made with have to be valid there as well.
+func (server *FileServer) webDAVAllows(req *http.Request, pathString string) bool {
+	if !server.clientCertAllows(req, pathString) {
+		return false
+	}
+	realm := server.authRealmFor(pathString)
+	if realm == nil || realm == server.authRealmFor(req.Uri.PathString()) {
+		return true
+	}
+	_, _, ok := realm.authenticate(req)
+	return ok
+}
+
+// Checks whether the request may reach a path and everything below it, since an operation on a whole collection
+// also reaches members that are protected more strictly than the collection itself.
+func (server *FileServer) webDAVAllowsSubtree(req *http.Request, pathString string) bool {
+	for _, realm := range server.authRealms {
+		if hasPathPrefix(realm.pathPrefix, pathString) && !server.webDAVAllows(req, realm.pathPrefix) {
+			return false
+		}
+	}
+	for _, rule := range server.clientCertRules {
+		if hasPathPrefix(rule.pathPrefix, pathString) && !server.webDAVAllows(req, rule.pathPrefix) {
+			return false
+		}
+	}
+	return server.webDAVAllows(req, pathString)
+}
+
+// Dispatches the WebDAV methods, which are only served below a WebDAV path.
+func (server *FileServer) handleWebDAVRequest(req *http.Request, writer *bufio.Writer) bool {
+	policy := server.webDAVPolicyFor(req.Uri.PathString())
+	if policy == nil {
+		server.respondErrorTemplate(writer, req, http.StatusMethodNotAllowed, false)
+		return req.WillCloseConnection()
+	}
+
+	switch req.Method {
+	case http.MethodPropfind:
+		return server.handlePropfindRequest(req, writer)
+	case http.MethodProppatch:
+		return server.handleProppatchRequest(req, writer)
+	case http.MethodMkcol:
+		return server.handleMkcolRequest(req, writer)
+	case http.MethodCopy, http.MethodMove:
+		return server.handleCopyOrMoveRequest(req, writer, policy)
+	case http.MethodLock:
+		return server.handleLockRequest(req, writer, policy)
+	case http.MethodUnlock:
+		return server.handleUnlockRequest(req, writer)
+	default:
+		return server.handleDeleteRequest(req, writer, policy)
+	}
+}
+
+func (server *FileServer) handlePropfindRequest(req *http.Request, writer *bufio.Writer) bool {
+	pathString, filePath := server.webDAVPaths(req)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		server.respondErrorTemplate(writer, req, http.StatusNotFound, false)
+		return req.WillCloseConnection()
+	}
+
+	depth, ok := parseDepth(req, true)
+	var propfind webDAVPropfind
+	hasBody, status := readWebDAVBody(req, &propfind)
+	if status == http.StatusOK && (!ok || (hasBody && propfind.AllProp == nil && propfind.PropName == nil && propfind.Prop == nil)) {
+		status = http.StatusBadRequest
+	}
+	if status != http.StatusOK {
+		server.respondErrorTemplate(writer, req, status, status == http.StatusEntityTooLarge)
+		return req.WillCloseConnection()
+	}
+
+	// Members the request may not reach are reported as forbidden, without their properties or members.
+	ms := newMultiStatus()
+	walkWebDAV(pathString, filePath, info, depth, func(pathString string, filePath string, info os.FileInfo) bool {
+		if !server.webDAVAllows(req, pathString) {
+			ms.addStatus(webDAVHref(pathString, info.IsDir()), http.StatusForbidden)
+			return false
+		}
+		ms.addPropStats(webDAVHref(pathString, info.IsDir()), server.resourceProperties(filePath, info, &propfind))
+		return true
+	})
+	server.newResponse(req).WithStatus(http.StatusMultiStatus).WithBody(ms.bytes(), http.MediaTypeXML).Respond(writer)
+	return req.WillCloseConnection()
+}
+
+// Sets and removes dead properties. Properties in the DAV namespace are protected, and since changes are applied
+// all or nothing, the other properties fail along with them.
+func (server *FileServer) handleProppatchRequest(req *http.Request, writer *bufio.Writer) bool {
+	pathString, filePath := server.webDAVPaths(req)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		server.respondErrorTemplate(writer, req, http.StatusNotFound, false)
+		return req.WillCloseConnection()
+	}
+	if !server.checkWebDAVLocks(req, writer, false, filePath) {
+		return req.WillCloseConnection()
+	}
+
+	var update webDAVPropertyUpdate
+	hasBody, status := readWebDAVBody(req, &update)
+	if status == http.StatusOK && !hasBody {
+		status = http.StatusBadRequest
+	}
+
+	var set []bool
+	var properties []webDAVProperty
+	protected := false
+	for _, operation := range update.Operations {
+		if operation.XMLName.Space != webDAVNamespace || (operation.XMLName.Local != "set" && operation.XMLName.Local != "remove") {
+			status = http.StatusBadRequest
+		}
+		for _, property := range operation.Prop.Properties {
+			set = append(set, operation.XMLName.Local == "set")
+			properties = append(properties, property)
+			protected = protected || property.XMLName.Space == webDAVNamespace
+		}
+	}
+	if status != http.StatusOK {
+		server.respondErrorTemplate(writer, req, status, status == http.StatusEntityTooLarge)
+		return req.WillCloseConnection()
+	}
+
+	results := map[http.StatusCode][]string{}
+	for _, property := range properties {
+		status := http.StatusOK
+		if property.XMLName.Space == webDAVNamespace {
+			status = http.StatusForbidden
+		} else if protected {
+			status = http.StatusFailedDependency
+		}
+		results[status] = append(results[status], propertyXML(property.XMLName, ""))
+	}
+	if !protected {
+		server.webDAVProperties.patch(filePath, set, properties)
+	}
+
+	ms := newMultiStatus()
+	ms.addPropStats(webDAVHref(pathString, info.IsDir()), results)
+	server.newResponse(req).WithStatus(http.StatusMultiStatus).WithBody(ms.bytes(), http.MediaTypeXML).Respond(writer)
+	return req.WillCloseConnection()
+}
+
+func (server *FileServer) handleMkcolRequest(req *http.Request, writer *bufio.Writer) bool {
+	pathString, filePath := server.webDAVPaths(req)
+	status := http.StatusCreated
+	if _, err := os.Lstat(filePath); err == nil {
+		status = http.StatusMethodNotAllowed
+	} else if req.ContentLength != 0 {
+		status = http.StatusUnsupportedMediaType
+	} else if name := path.Base(pathString); sanitizeFileName(name) != name {
+		status = http.StatusBadRequest
+	} else if !isDirectory(filepath.Dir(filePath)) {
+		status = http.StatusConflict
+	}
+	if status != http.StatusCreated {
+		server.respondErrorTemplate(writer, req, status, false)
+		return req.WillCloseConnection()
+	}
+	if !server.checkWebDAVLocks(req, writer, false, filePath, filepath.Dir(filePath)) {
+		return req.WillCloseConnection()
+	}
+
+	server.uploadLock.Lock()
+	err := os.Mkdir(filePath, 0755)
+	server.uploadLock.Unlock()
+	if err != nil {
+		status = http.StatusMethodNotAllowed
+		if !os.IsExist(err) {
+			log.Println("An issue occurred while creating a collection.")
+			status = http.StatusInternalServerError
+		}
+		server.respondErrorTemplate(writer, req, status, false)
+		return req.WillCloseConnection()
+	}
+
+	server.newResponse(req).WithStatus(http.StatusCreated).Respond(writer)
+	return req.WillCloseConnection()
+}
+
+func (server *FileServer) handleDeleteRequest(req *http.Request, writer *bufio.Writer, policy *webDAVPolicy) bool {
+	pathString, filePath := server.webDAVPaths(req)
+	info, err := os.Lstat(filePath)
+	status := http.StatusNoContent
+	if err != nil {
+		status = http.StatusNotFound
+	} else if policy.pathPrefix == pathString {
+		status = http.StatusForbidden
+	} else if depth, ok := parseDepth(req, false); info.IsDir() && (!ok || depth >= 0) {
+		status = http.StatusBadRequest
+	} else if info.IsDir() && !server.webDAVAllowsSubtree(req, pathString) {
+		status = http.StatusForbidden
+	}
+	if status != http.StatusNoContent {
+		server.respondErrorTemplate(writer, req, status, false)
+		return req.WillCloseConnection()
+	}
+	if !server.checkWebDAVLocks(req, writer, true, filePath) ||
+		!server.checkWebDAVLocks(req, writer, false, filepath.Dir(filePath)) {
+		return req.WillCloseConnection()
+	}
+
+	server.uploadLock.Lock()
+	err = os.RemoveAll(filePath)
+	server.uploadLock.Unlock()
+	if err != nil {
+		log.Println("An issue occurred while deleting a resource.")
+		server.respondErrorTemplate(writer, req, http.StatusInternalServerError, false)
+		return req.WillCloseConnection()
+	}
+
+	server.webDAVLocks.removeAll(filePath)
+	server.webDAVProperties.removeAll(filePath)
+	server.invalidateResource(filePath, info.IsDir())
+	server.newResponse(req).WithStatus(http.StatusNoContent).Respond(writer)
+	return req.WillCloseConnection()
+}
+
+// Copies or moves a resource to the `Destination` header, which has to be on the same site and served with WebDAV.
+// A collection is moved with all its members, and copied either with them or on its own.
+func (server *FileServer) handleCopyOrMoveRequest(req *http.Request, writer *bufio.Writer, policy *webDAVPolicy) bool {
+	move := req.Method == http.MethodMove
+	pathString, filePath := server.webDAVPaths(req)
+	destPathString, status := server.webDAVDestination(req)
+	site, _ := server.siteFor(req)
+	destFilePath := site.fileRoot + destPathString
+
+	info, err := os.Lstat(filePath)
+	depth, ok := parseDepth(req, false)
+	overwrite := req.Headers.Get(http.HeaderOverwrite)
+	if err != nil {
+		status = http.StatusNotFound
+	} else if !ok || (move && depth >= 0) || (overwrite != "" && overwrite != "T" && overwrite != "F") {
+		status = http.StatusBadRequest
+	} else if status == http.StatusOK && (hasPathPrefix(destFilePath, filePath) || hasPathPrefix(filePath, destFilePath) ||
+		(move && policy.pathPrefix == pathString)) {
+		status = http.StatusForbidden
+	} else if status == http.StatusOK && (!server.webDAVAllowsSubtree(req, destPathString) ||
+		info.IsDir() && (move || depth != 0) && !server.webDAVAllowsSubtree(req, pathString)) {
+		status = http.StatusForbidden
+	} else if status == http.StatusOK && !isDirectory(filepath.Dir(destFilePath)) {
+		status = http.StatusConflict
+	}
+
+	_, err = os.Lstat(destFilePath)
+	existed := err == nil
+	if status == http.StatusOK && existed && overwrite == "F" {
+		status = http.StatusPreconditionFailed
+	}
+	if status != http.StatusOK {
+		server.respondErrorTemplate(writer, req, status, false)
+		return req.WillCloseConnection()
+	}
+
+	if !server.checkWebDAVLocks(req, writer, true, destFilePath) ||
+		!server.checkWebDAVLocks(req, writer, false, filepath.Dir(destFilePath)) {
+		return req.WillCloseConnection()
+	}
+	if move && (!server.checkWebDAVLocks(req, writer, true, filePath) ||
+		!server.checkWebDAVLocks(req, writer, false, filepath.Dir(filePath))) {
+		return req.WillCloseConnection()
+	}
+
+	server.uploadLock.Lock()
+	err = nil
+	if existed {
+		err = os.RemoveAll(destFilePath)
+	}
+	if err == nil && move {
+		err = os.Rename(filePath, destFilePath)
+	} else if err == nil {
+		err = copyWebDAVResource(filePath, destFilePath, info, depth != 0)
+	}
+	server.uploadLock.Unlock()
+	if err != nil {
+		log.Println("An issue occurred while copying or moving a resource.")
+		server.respondErrorTemplate(writer, req, http.StatusInternalServerError, false)
+		return req.WillCloseConnection()
+	}
+
+	server.webDAVProperties.transfer(filePath, destFilePath, move, depth != 0)
+	if move {
+		server.webDAVLocks.removeAll(filePath)
+		server.invalidateResource(filePath, info.IsDir())
+	}
+	server.invalidateResource(destFilePath, info.IsDir())
+
+	status = http.StatusCreated
+	if existed {
+		status = http.StatusNoContent
+	}
+	server.newResponse(req).WithStatus(status).Respond(writer)
+	return req.WillCloseConnection()
+}
+
+// Creates a lock, or refreshes one submitted in the `If` header if the body is empty. Locking an unmapped path
+// creates an empty file there.
+func (server *FileServer) handleLockRequest(req *http.Request, writer *bufio.Writer, policy *webDAVPolicy) bool {
+	pathString, filePath := server.webDAVPaths(req)
+	timeout := parseLockTimeout(req.Headers.Get(http.HeaderTimeout), policy.maxLockTimeout)
+
+	var info webDAVLockInfo
+	hasBody, status := readWebDAVBody(req, &info)
+	if status != http.StatusOK {
+		server.respondErrorTemplate(writer, req, status, status == http.StatusEntityTooLarge)
+		return req.WillCloseConnection()
+	}
+
+	if !hasBody {
+		lock := server.webDAVLocks.refresh(filePath, submittedLockTokens(req), timeout)
+		if lock == nil {
+			server.respondErrorTemplate(writer, req, http.StatusPreconditionFailed, false)
+			return req.WillCloseConnection()
+		}
+		return server.respondLock(req, writer, http.StatusOK, *lock, false)
+	}
+
+	depth, ok := parseDepth(req, false)
+	if !ok || info.Write == nil || (info.Exclusive == nil) == (info.Shared == nil) {
+		server.respondErrorTemplate(writer, req, http.StatusBadRequest, false)
+		return req.WillCloseConnection()
+	}
+
+	fileInfo, err := os.Lstat(filePath)
+	exists := err == nil
+	if name := path.Base(pathString); !exists && sanitizeFileName(name) != name {
+		status = http.StatusBadRequest
+	} else if !exists && !isDirectory(filepath.Dir(filePath)) {
+		status = http.StatusConflict
+	}
+	if status != http.StatusOK {
+		server.respondErrorTemplate(writer, req, status, false)
+		return req.WillCloseConnection()
+	}
+	if !exists && !server.checkWebDAVLocks(req, writer, false, filepath.Dir(filePath)) {
+		return req.WillCloseConnection()
+	}
+
+	lock := &webDAVLock{
+		filePath:  filePath,
+		href:      webDAVHref(pathString, exists && fileInfo.IsDir()),
+		infinite:  depth < 0,
+		exclusive: info.Exclusive != nil,
+		timeout:   timeout,
+	}
+	if info.Owner != nil {
+		lock.owner = info.Owner.InnerXML
+	}
+	if !server.webDAVLocks.create(lock) {
+		server.respondErrorTemplate(writer, req, http.StatusLocked, false)
+		return req.WillCloseConnection()
+	}
+
+	status = http.StatusOK
+	if !exists {
+		server.uploadLock.Lock()
+		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			err = file.Close()
+		}
+		server.uploadLock.Unlock()
+		if err != nil && !os.IsExist(err) {
+			log.Println("An issue occurred while creating a locked resource.")
+			server.webDAVLocks.remove(filePath, lock.token)
+			server.respondErrorTemplate(writer, req, http.StatusInternalServerError, false)
+			return req.WillCloseConnection()
+		}
+		status = http.StatusCreated
+		server.fileCache.invalidate(filePath)
+	}
+	return server.respondLock(req, writer, status, *lock, true)
+}
+
+func (server *FileServer) respondLock(
+	req *http.Request,
+	writer *bufio.Writer,
+	status http.StatusCode,
+	lock webDAVLock,
+	withToken bool,
+) bool {
+	content := `<?xml version="1.0" encoding="utf-8"?>` + "\n" +
+		`<D:prop xmlns:D="DAV:">` + xmlElement("D:lockdiscovery", activeLockXML(lock)) + "</D:prop>\n"
+
+	res := server.newResponse(req).WithStatus(status).WithBody([]byte(content), http.MediaTypeXML)
+	if withToken {
+		res.WithHeader(http.HeaderLockToken, "<"+lock.token+">")
+	}
+	res.Respond(writer)
+	return req.WillCloseConnection()
+}
+
+func (server *FileServer) handleUnlockRequest(req *http.Request, writer *bufio.Writer) bool {
+	_, filePath := server.webDAVPaths(req)
+	token := req.Headers.Get(http.HeaderLockToken)
+	if !strings.HasPrefix(token, "<") || !strings.HasSuffix(token, ">") {
+		server.respondErrorTemplate(writer, req, http.StatusBadRequest, false)
+		return req.WillCloseConnection()
+	}
+	if !server.webDAVLocks.remove(filePath, token[1:len(token)-1]) {
+		server.respondErrorTemplate(writer, req, http.StatusConflict, false)
+		return req.WillCloseConnection()
+	}
+
+	server.newResponse(req).WithStatus(http.StatusNoContent).Respond(writer)
+	return req.WillCloseConnection()
+}
+
+// Resolves the `Destination` header to a path, returning the status to respond with if it is not acceptable.
+func (server *FileServer) webDAVDestination(req *http.Request) (string, http.StatusCode) {
+	header := req.Headers.Get(http.HeaderDestination)
+	ref, err := http.ParseUriReference(header)
+	if header == "" || err != nil {
+		return "", http.StatusBadRequest
+	}
+	if ref.Host() != "" && !strings.EqualFold(strings.TrimSuffix(ref.Host(), "."), requestHost(req)) {
+		return "", http.StatusBadGateway
+	}
+
+	target, err := http.ParseUri(http.MethodGet, ref.RawPath())
+	if err != nil {
+		return "", http.StatusBadRequest
+	}
+	pathString := strings.TrimSuffix(target.PathString(), "/")
+	if server.webDAVPolicyFor(target.PathString()) == nil {
+		return "", http.StatusForbidden
+	}
+	if name := path.Base(pathString); sanitizeFileName(name) != name {
+		return "", http.StatusBadRequest
+	}
+	return pathString, http.StatusOK
+}
+
+func (server *FileServer) resourceProperties(
+	filePath string,
+	info os.FileInfo,
+	propfind *webDAVPropfind,
+) map[http.StatusCode][]string {
+	properties := map[http.StatusCode][]string{}
+	dead := server.webDAVProperties.get(filePath)
+
+	if propfind.Prop != nil {
+		for _, requested := range propfind.Prop.Properties {
+			value, ok := "", false
+			if requested.XMLName.Space == webDAVNamespace {
+				value, ok = server.liveProperty(filePath, info, requested.XMLName.Local)
+			}
+			for _, property := range dead {
+				if property.XMLName == requested.XMLName {
+					value, ok = property.InnerXML, true
+				}
+			}
+			if ok {
+				properties[http.StatusOK] = append(properties[http.StatusOK], propertyXML(requested.XMLName, value))
+			} else {
+				properties[http.StatusNotFound] = append(properties[http.StatusNotFound], propertyXML(requested.XMLName, ""))
+			}
+		}
+		return properties
+	}
+
+	for _, name := range webDAVLiveProperties {
+		if value, ok := server.liveProperty(filePath, info, name); ok {
+			if propfind.PropName != nil {
+				value = ""
+			}
+			properties[http.StatusOK] = append(properties[http.StatusOK], propertyXML(xml.Name{Space: webDAVNamespace, Local: name}, value))
+		}
+	}
+	for _, property := range dead {
+		value := property.InnerXML
+		if propfind.PropName != nil {
+			value = ""
+		}
+		properties[http.StatusOK] = append(properties[http.StatusOK], propertyXML(property.XMLName, value))
+	}
+	return properties
+}
+
+// Returns the XML content of a live property, or false if the property does not apply to the resource.
+func (server *FileServer) liveProperty(filePath string, info os.FileInfo, name string) (string, bool) {
+	switch name {
+	case "displayname":
+		return escapeXML(info.Name()), true
+	case "getcontentlength":
+		return strconv.FormatInt(info.Size(), 10), !info.IsDir()
+	case "getcontenttype":
+		return escapeXML(string(server.contentTypeByExt(uploadExt(info.Name())))), !info.IsDir()
+	case "getetag":
+		if file, err := server.fileCache.get(filePath); err == nil && !info.IsDir() {
+			return escapeXML("\"" + file.eTag + "\""), true
+		}
+	case "getlastmodified":
+		return formatTimeGMT(info.ModTime()), true
+	case "lockdiscovery":
+		var locks strings.Builder
+		for _, lock := range server.webDAVLocks.active(filePath) {
+			locks.WriteString(activeLockXML(lock))
+		}
+		return locks.String(), true
+	case "resourcetype":
+		if info.IsDir() {
+			return "<D:collection/>", true
+		}
+		return "", true
+	case "supportedlock":
+		return supportedLockXML, true
+	}
+	return "", false
+}
+
+func (server *FileServer) invalidateResource(filePath string, isDir bool) {
+	if isDir {
+		server.fileCache.invalidateAll()
+	} else {
+		server.fileCache.invalidate(filePath)
+	}
+}
+
+// Calls a function for a resource and its members down to the given depth, where a negative depth is infinite.
+// Hidden files, like staged uploads, are skipped.
+func walkWebDAV(
+	pathString string,
+	filePath string,
+	info os.FileInfo,
+	depth int,
+	f func(pathString string, filePath string, info os.FileInfo) bool,
+) {
+	if !f(pathString, filePath, info) || !info.IsDir() || depth == 0 {
+		return
+	}
+
+	children, err := ioutil.ReadDir(filePath)
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		if !strings.HasPrefix(child.Name(), ".") {
+			walkWebDAV(pathString+"/"+child.Name(), filePath+"/"+child.Name(), child, depth-1, f)
+		}
+	}
+}
+
+func copyWebDAVResource(from string, to string, info os.FileInfo, deep bool) error {
+	if !info.IsDir() {
+		return copyFile(from, to, info.Mode().Perm())
+	}
+	if err := os.Mkdir(to, info.Mode().Perm()); err != nil || !deep {
+		return err
+	}
+
+	children, err := ioutil.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := copyWebDAVResource(from+"/"+child.Name(), to+"/"+child.Name(), child, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(from string, to string, mode os.FileMode) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func webDAVHref(pathString string, isDir bool) string {
+	href := http.EncodePercent(pathString, http.UriComponentPath)
+	if isDir {
+		href += "/"
+	}
+	return href
+}
+
+// Parses the `Depth` header, returning -1 for infinity, which is also the default.
+func parseDepth(req *http.Request, allowOne bool) (int, bool) {
+	switch strings.ToLower(req.Headers.Get(http.HeaderDepth)) {
+	case "", "infinity":
+		return -1, true
+	case "0":
+		return 0, true
+	case "1":
+		return 1, allowOne
+	}
+	return 0, false
+}
+
+// Decodes an XML request body, returning false if the body is empty.
+func readWebDAVBody(req *http.Request, v interface{}) (bool, http.StatusCode) {
+	content, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return false, uploadReadStatus(err)
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return false, http.StatusOK
+	}
+	if err := xml.Unmarshal(content, v); err != nil {
+		return true, http.StatusBadRequest
+	}
+	return true, http.StatusOK
+}
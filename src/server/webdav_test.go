@@ -0,0 +1,98 @@
+package server_test
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"path/filepath"
+	"segaline/src/http"
+	"segaline/src/segalinetest"
+	"segaline/src/server"
+	"strings"
+	"testing"
+)
+
+const lockInfo = `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope>` +
+	`<D:locktype><D:write/></D:locktype></D:lockinfo>`
+
+func TestWebDAVMethodsAfterRewriteOutsideWebDAV(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).Mkdir("dav").WriteFile("files/x.txt", "x")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		WebDAV:       []server.WebDAVConfig{{PathPrefix: "/dav"}},
+		RewriteRules: []server.RewriteRuleConfig{{Path: "^/dav/old/(.*)$", Rewrite: "/files/$1"}},
+	})
+
+	for _, method := range []http.Method{http.MethodDelete, http.MethodMove, http.MethodLock, http.MethodPut} {
+		testServer.Do(segalinetest.NewRequest(method, "/dav/old/x.txt")).AssertStatus(http.StatusMethodNotAllowed)
+	}
+	if _, ok := fixture.ReadFile("files/x.txt"); !ok {
+		t.Error("expected the file outside WebDAV to be kept")
+	}
+}
+
+func TestWebDAVLockCoversMultipartUploads(t *testing.T) {
+	fixture := segalinetest.NewFixture(t).Mkdir("dav/locked")
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		WebDAV: []server.WebDAVConfig{{PathPrefix: "/dav"}},
+	})
+
+	testServer.Do(segalinetest.NewRequest(http.MethodLock, "/dav/locked").
+		WithHeader(http.HeaderDepth, "infinity").
+		WithBody(lockInfo, http.MediaTypeXML)).
+		AssertStatus(http.StatusOK)
+
+	body := strings.Join([]string{
+		"--b",
+		`Content-Disposition: form-data; name="file"; filename="a.txt"`,
+		"Content-Type: text/plain",
+		"",
+		"content",
+		"--b--",
+		"",
+	}, "\r\n")
+	testServer.Do(segalinetest.NewRequest(http.MethodPost, "/dav/locked/").
+		WithBody(body, "multipart/form-data; boundary=b")).
+		AssertStatus(http.StatusLocked)
+	if _, ok := fixture.ReadFile("dav/locked/a.txt"); ok {
+		t.Error("expected no file to be stored in the locked collection")
+	}
+}
+
+func TestWebDAVRespectsStricterRealmsBelowTarget(t *testing.T) {
+	sum := sha1.Sum([]byte("secret"))
+	fixture := segalinetest.NewFixture(t).
+		WriteFile("dav/a.txt", "a").
+		WriteFile("dav/dir/private/secret.txt", "secret").
+		WriteTemplate("users", "admin:{SHA}"+base64.StdEncoding.EncodeToString(sum[:]))
+	testServer := segalinetest.NewServer(t, fixture, &server.Config{
+		WebDAV: []server.WebDAVConfig{{PathPrefix: "/dav"}},
+		Auth: []server.AuthConfig{{
+			PathPrefix: "/dav/dir/private",
+			Realm:      "private",
+			Scheme:     "basic",
+			UserFile:   filepath.Join(fixture.TemplateRoot, "users"),
+		}},
+	})
+
+	move := func() *segalinetest.Request {
+		return segalinetest.NewRequest(http.MethodMove, "/dav/a.txt").
+			WithHeader(http.HeaderDestination, "/dav/dir/private/a.txt")
+	}
+	testServer.Do(move()).AssertStatus(http.StatusForbidden)
+	testServer.Do(segalinetest.NewRequest(http.MethodDelete, "/dav/dir")).AssertStatus(http.StatusForbidden)
+	testServer.Do(segalinetest.NewRequest(http.MethodCopy, "/dav/dir").WithHeader(http.HeaderDestination, "/dav/copy")).
+		AssertStatus(http.StatusForbidden)
+	if _, ok := fixture.ReadFile("dav/dir/private/secret.txt"); !ok {
+		t.Error("expected the protected file to be kept")
+	}
+
+	propfind := segalinetest.NewRequest(http.MethodPropfind, "/dav/dir").WithHeader(http.HeaderDepth, "infinity")
+	result := testServer.Do(propfind).
+		AssertStatus(http.StatusMultiStatus).
+		AssertBodyContains("<D:href>/dav/dir/private/</D:href><D:status>HTTP/1.1 403 Forbidden</D:status>")
+	if strings.Contains(result.Body(), "secret.txt") {
+		t.Errorf("expected the protected members to be left out, got %q", result.Body())
+	}
+
+	credentials := base64.StdEncoding.EncodeToString([]byte("admin:secret"))
+	testServer.Do(move().WithHeader(http.HeaderAuthorization, "Basic "+credentials)).AssertStatus(http.StatusCreated)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"segaline/src/http"
+	"segaline/src/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const webDAVLockTokenPrefix = "urn:uuid:"
+
+type webDAVLock struct {
+	token     string
+	filePath  string
+	href      string
+	infinite  bool
+	exclusive bool
+	owner     string
+	timeout   time.Duration
+	expires   time.Time
+}
+
+// Write locks are only kept in memory, so they are released when the server restarts.
+type webDAVLockStore struct {
+	locks map[string]*webDAVLock
+	lock  sync.Mutex
+}
+
+func newWebDAVLockStore() *webDAVLockStore {
+	return &webDAVLockStore{locks: map[string]*webDAVLock{}}
+}
+
+// Whether a lock applies to a path, either directly or through an ancestor locked with infinite depth.
+func (lock *webDAVLock) covers(filePath string) bool {
+	return lock.filePath == filePath || (lock.infinite && hasPathPrefix(filePath, lock.filePath))
+}
+
+// Returns the unexpired locks that apply to a path, including locks on its descendants if deep is set.
+// This must be called with the store lock held.
+func (store *webDAVLockStore) find(filePath string, deep bool) []*webDAVLock {
+	var locks []*webDAVLock
+	now := time.Now()
+	for token, lock := range store.locks {
+		if now.After(lock.expires) {
+			delete(store.locks, token)
+		} else if lock.covers(filePath) || (deep && hasPathPrefix(lock.filePath, filePath)) {
+			locks = append(locks, lock)
+		}
+	}
+	return locks
+}
+
+// Whether every lock that applies to a path is one of the submitted tokens.
+func (store *webDAVLockStore) allows(filePath string, deep bool, tokens []string) bool {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, lock := range store.find(filePath, deep) {
+		if !containsString(tokens, lock.token) {
+			return false
+		}
+	}
+	return true
+}
+
+// Creates a lock unless it conflicts with an existing one. Exclusive locks conflict with any other lock, while
+// shared locks only conflict with exclusive ones.
+func (store *webDAVLockStore) create(lock *webDAVLock) bool {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, existing := range store.find(lock.filePath, lock.infinite) {
+		if lock.exclusive || existing.exclusive {
+			return false
+		}
+	}
+	lock.token = newWebDAVLockToken()
+	lock.expires = time.Now().Add(lock.timeout)
+	store.locks[lock.token] = lock
+	return true
+}
+
+// Extends the timeout of the first submitted lock that applies to a path.
+func (store *webDAVLockStore) refresh(filePath string, tokens []string, timeout time.Duration) *webDAVLock {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, lock := range store.find(filePath, false) {
+		if containsString(tokens, lock.token) {
+			lock.timeout = timeout
+			lock.expires = time.Now().Add(timeout)
+			return lock
+		}
+	}
+	return nil
+}
+
+func (store *webDAVLockStore) remove(filePath string, token string) bool {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, lock := range store.find(filePath, false) {
+		if lock.token == token {
+			delete(store.locks, token)
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the locks on a path and its descendants, since locks do not follow a resource when it is moved or deleted.
+func (store *webDAVLockStore) removeAll(filePath string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for token, lock := range store.locks {
+		if hasPathPrefix(lock.filePath, filePath) {
+			delete(store.locks, token)
+		}
+	}
+}
+
+func (store *webDAVLockStore) active(filePath string) []webDAVLock {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	var locks []webDAVLock
+	for _, lock := range store.find(filePath, false) {
+		locks = append(locks, *lock)
+	}
+	return locks
+}
+
+func newWebDAVLockToken() string {
+	uuid := make([]byte, 16)
+	_, _ = rand.Read(uuid)
+	uuid[6] = uuid[6]&0x0F | 0x40
+	uuid[8] = uuid[8]&0x3F | 0x80
+	return fmt.Sprintf("%s%x-%x-%x-%x-%x", webDAVLockTokenPrefix, uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// Collects the lock tokens submitted in the `If` header. Conditions are not evaluated, so a token counts as
+// submitted wherever it appears in the header.
+func submittedLockTokens(req *http.Request) []string {
+	var tokens []string
+	header := req.Headers.Get(http.HeaderIf)
+	for {
+		start := strings.Index(header, "<")
+		end := strings.Index(header, ">")
+		if start < 0 || end < start {
+			return tokens
+		}
+		if token := header[start+1 : end]; strings.HasPrefix(token, webDAVLockTokenPrefix) {
+			tokens = append(tokens, token)
+		}
+		header = header[end+1:]
+	}
+}
+
+// Parses a `Timeout` header, which lists timeouts in order of preference, falling back to the default timeout.
+// Timeouts are capped to the maximum, which is also used for `Infinite`.
+func parseLockTimeout(header string, max time.Duration) time.Duration {
+	for _, timeout := range strings.Split(header, ",") {
+		timeout = strings.TrimSpace(timeout)
+		if strings.EqualFold(timeout, "Infinite") {
+			return max
+		}
+		if strings.HasPrefix(timeout, "Second-") {
+			if seconds, err := strconv.ParseUint(timeout[len("Second-"):], 10, 32); err == nil {
+				if duration := time.Duration(seconds) * time.Second; duration < max {
+					return duration
+				}
+				return max
+			}
+		}
+	}
+	if util.DefaultWebDAVLockTimeout < max {
+		return util.DefaultWebDAVLockTimeout
+	}
+	return max
+}
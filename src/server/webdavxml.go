@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"segaline/src/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const webDAVNamespace = "DAV:"
+
+type webDAVProperty struct {
+	XMLName  xml.Name
+	InnerXML string `xml:",innerxml"`
+}
+
+type webDAVPropertyList struct {
+	Properties []webDAVProperty `xml:",any"`
+}
+
+type webDAVPropfind struct {
+	XMLName  xml.Name            `xml:"DAV: propfind"`
+	AllProp  *struct{}           `xml:"DAV: allprop"`
+	PropName *struct{}           `xml:"DAV: propname"`
+	Prop     *webDAVPropertyList `xml:"DAV: prop"`
+}
+
+type webDAVPropertyUpdate struct {
+	XMLName    xml.Name `xml:"DAV: propertyupdate"`
+	Operations []struct {
+		XMLName xml.Name
+		Prop    webDAVPropertyList `xml:"DAV: prop"`
+	} `xml:",any"`
+}
+
+type webDAVLockInfo struct {
+	XMLName   xml.Name  `xml:"DAV: lockinfo"`
+	Exclusive *struct{} `xml:"DAV: lockscope>exclusive"`
+	Shared    *struct{} `xml:"DAV: lockscope>shared"`
+	Write     *struct{} `xml:"DAV: locktype>write"`
+	Owner     *struct {
+		InnerXML string `xml:",innerxml"`
+	} `xml:"DAV: owner"`
+}
+
+// Dead properties set with `PROPPATCH` are only kept in memory, like locks.
+type webDAVPropertyStore struct {
+	properties map[string][]webDAVProperty
+	lock       sync.Mutex
+}
+
+func newWebDAVPropertyStore() *webDAVPropertyStore {
+	return &webDAVPropertyStore{properties: map[string][]webDAVProperty{}}
+}
+
+func (store *webDAVPropertyStore) get(filePath string) []webDAVProperty {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return append([]webDAVProperty(nil), store.properties[filePath]...)
+}
+
+// Sets or removes properties in order, as given by the set flags.
+func (store *webDAVPropertyStore) patch(filePath string, set []bool, properties []webDAVProperty) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	stored := store.properties[filePath]
+	for index, property := range properties {
+		kept := stored[:0:0]
+		for _, existing := range stored {
+			if existing.XMLName != property.XMLName {
+				kept = append(kept, existing)
+			}
+		}
+		if set[index] {
+			kept = append(kept, property)
+		}
+		stored = kept
+	}
+
+	if len(stored) == 0 {
+		delete(store.properties, filePath)
+	} else {
+		store.properties[filePath] = stored
+	}
+}
+
+// Copies or moves the properties of a path, and of its descendants if deep is set, to another path. The properties
+// previously stored for the destination are removed. The paths must not contain each other.
+func (store *webDAVPropertyStore) transfer(from string, to string, move bool, deep bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for filePath := range store.properties {
+		if hasPathPrefix(filePath, to) {
+			delete(store.properties, filePath)
+		}
+	}
+	for filePath, properties := range store.properties {
+		if filePath == from || (deep && hasPathPrefix(filePath, from)) {
+			store.properties[to+filePath[len(from):]] = properties
+			if move {
+				delete(store.properties, filePath)
+			}
+		}
+	}
+}
+
+func (store *webDAVPropertyStore) removeAll(filePath string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for path := range store.properties {
+		if hasPathPrefix(path, filePath) {
+			delete(store.properties, path)
+		}
+	}
+}
+
+// Builds a `207 Multi-Status` body, which reports a status for each resource or each of its properties.
+type multiStatus struct {
+	buf bytes.Buffer
+}
+
+func newMultiStatus() *multiStatus {
+	ms := &multiStatus{}
+	ms.buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<D:multistatus xmlns:D="DAV:">`)
+	return ms
+}
+
+func (ms *multiStatus) addStatus(href string, status http.StatusCode) {
+	ms.buf.WriteString("<D:response>" + xmlElement("D:href", escapeXML(href)) + xmlElement("D:status", statusLine(status)))
+	ms.buf.WriteString("</D:response>")
+}
+
+// Adds a response with the properties grouped by status, in ascending order of status.
+func (ms *multiStatus) addPropStats(href string, properties map[http.StatusCode][]string) {
+	statuses := make([]int, 0, len(properties))
+	for status := range properties {
+		statuses = append(statuses, int(status))
+	}
+	sort.Ints(statuses)
+
+	ms.buf.WriteString("<D:response>" + xmlElement("D:href", escapeXML(href)))
+	for _, status := range statuses {
+		ms.buf.WriteString("<D:propstat><D:prop>")
+		for _, property := range properties[http.StatusCode(status)] {
+			ms.buf.WriteString(property)
+		}
+		ms.buf.WriteString("</D:prop>" + xmlElement("D:status", statusLine(http.StatusCode(status))) + "</D:propstat>")
+	}
+	ms.buf.WriteString("</D:response>")
+}
+
+func (ms *multiStatus) bytes() []byte {
+	return append(ms.buf.Bytes(), "</D:multistatus>\n"...)
+}
+
+// Formats a property element with raw XML content. Properties outside the DAV namespace declare their own.
+func propertyXML(name xml.Name, innerXML string) string {
+	start := "D:" + name.Local
+	if name.Space != webDAVNamespace {
+		start = fmt.Sprintf(`R:%s xmlns:R="%s"`, name.Local, escapeXML(name.Space))
+		if name.Space == "" {
+			start = name.Local + ` xmlns=""`
+		}
+	}
+	end := start
+	if space := strings.IndexByte(start, ' '); space >= 0 {
+		end = start[:space]
+	}
+
+	if innerXML == "" {
+		return "<" + start + "/>"
+	}
+	return "<" + start + ">" + innerXML + "</" + end + ">"
+}
+
+func activeLockXML(lock webDAVLock) string {
+	scope, depth := "<D:shared/>", "0"
+	if lock.exclusive {
+		scope = "<D:exclusive/>"
+	}
+	if lock.infinite {
+		depth = "infinity"
+	}
+	return "<D:activelock><D:locktype><D:write/></D:locktype>" +
+		xmlElement("D:lockscope", scope) +
+		xmlElement("D:depth", depth) +
+		propertyXML(xml.Name{Space: webDAVNamespace, Local: "owner"}, lock.owner) +
+		xmlElement("D:timeout", "Second-"+strconv.Itoa(int(lock.timeout/time.Second))) +
+		xmlElement("D:locktoken", xmlElement("D:href", escapeXML(lock.token))) +
+		xmlElement("D:lockroot", xmlElement("D:href", escapeXML(lock.href))) +
+		"</D:activelock>"
+}
+
+const supportedLockXML = "<D:lockentry><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype>" +
+	"</D:lockentry><D:lockentry><D:lockscope><D:shared/></D:lockscope><D:locktype><D:write/></D:locktype>" +
+	"</D:lockentry>"
+
+func xmlElement(name string, content string) string {
+	return "<" + name + ">" + content + "</" + name + ">"
+}
+
+func escapeXML(str string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(str))
+	return buf.String()
+}
+
+func statusLine(status http.StatusCode) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", status, http.ReasonPhrase(status))
+}
@@ -11,13 +11,43 @@ const (
 const (
 	DefaultEmptyRequestTarget    = "/index.html"
 	DefaultReadTimeout           = 10 * time.Second
-	DefaultFallbackErrorTemplate = "{statusCode} - {serverInfo}"
+	DefaultFallbackErrorTemplate = "{{.StatusCode}} {{.ReasonPhrase}} - {{.ServerInfo}}"
+	DefaultDigestNonceLifetime   = 5 * time.Minute
+	DefaultRewriteReloadInterval = 2 * time.Second
+	DefaultSPACacheControl       = "no-cache"
+	DefaultFileCacheMemoryBudget = 64 << 20
+	DefaultFileCacheMaxFileSize  = 1 << 20
+	DefaultWatchPollInterval     = 2 * time.Second
+	DefaultUploadMaxFileSize     = 16 << 20
+	DefaultUploadMaxTotalSize    = 64 << 20
+	DefaultWebDAVLockTimeout     = 10 * time.Minute
+	DefaultWebDAVMaxLockTimeout  = time.Hour
+)
+
+const (
+	ClientDefaultTimeout        = 30 * time.Second
+	ClientDefaultIdleTimeout    = 90 * time.Second
+	ClientDefaultMaxIdlePerHost = 4
+	ClientDefaultMaxRedirects   = 10
+	ClientDefaultMaxBodySize    = 64 << 20
+)
+
+const TestResponseTimeout = 5 * time.Second
+
+const CSPNoncePlaceholder = "{cspNonce}"
+
+const (
+	LiveReloadScriptPath        = "/__segaline/livereload.js"
+	LiveReloadEventPath         = "/__segaline/livereload"
+	LiveReloadHeartbeatInterval = 15 * time.Second
 )
 
 const (
 	RequestMaxContentLength = 65_536
+	RequestMaxDrainLength   = 262_144
 	RequestMaxURILength     = 32_768
 	RequestOWS              = " \t"
+	RewriteMaxIterations    = 10
 )
 
 const (
@@ -32,4 +62,5 @@ const (
 	ErrorUnsupportedMethod           = "unsupported method"
 	ErrorUnsupportedTransferEncoding = "unsupported transfer encoding"
 	ErrorTimeoutReached              = "timeout reached"
+	ErrorUnsupportedMediaType        = "unsupported media type"
 )
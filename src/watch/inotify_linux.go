@@ -0,0 +1,129 @@
+//go:build linux
+// +build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+type inotifyWatcher struct {
+	dispatcher
+
+	file      *os.File
+	fd        int
+	paths     map[int32]string
+	pathsLock sync.Mutex
+}
+
+func newInotifyWatcher(roots []string) (*inotifyWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	// A non-blocking descriptor lets reads go through the runtime poller, so closing the file unblocks them.
+	watcher := &inotifyWatcher{
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		fd:    fd,
+		paths: map[int32]string{},
+	}
+	for _, root := range roots {
+		if err := watcher.addTree(root); err != nil {
+			watcher.file.Close()
+			return nil, err
+		}
+	}
+
+	go watcher.run()
+	return watcher, nil
+}
+
+func (watcher *inotifyWatcher) Close() error {
+	return watcher.file.Close()
+}
+
+// Inotify is not recursive, so every directory in the tree gets its own watch.
+func (watcher *inotifyWatcher) addTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+
+		wd, err := syscall.InotifyAddWatch(watcher.fd, path, inotifyMask)
+		if err != nil {
+			return err
+		}
+		watcher.pathsLock.Lock()
+		watcher.paths[int32(wd)] = path
+		watcher.pathsLock.Unlock()
+		return nil
+	})
+}
+
+func (watcher *inotifyWatcher) run() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := watcher.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				watcher.dispatch(Event{Kind: EventOverflowed})
+				continue
+			}
+			watcher.handle(raw.Wd, raw.Mask, string(trimNull(nameBytes)))
+		}
+	}
+}
+
+func (watcher *inotifyWatcher) handle(wd int32, mask uint32, name string) {
+	watcher.pathsLock.Lock()
+	dir, ok := watcher.paths[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(watcher.paths, wd)
+	}
+	watcher.pathsLock.Unlock()
+	if !ok {
+		return
+	}
+
+	path := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	switch {
+	case mask&syscall.IN_DELETE_SELF != 0:
+		// The parent directory reports the removal as well.
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		if isDir {
+			// Errors are ignored since the directory may already have been removed again.
+			_ = watcher.addTree(path)
+		}
+		watcher.dispatch(Event{path, EventCreated, isDir})
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		watcher.dispatch(Event{path, EventRemoved, isDir})
+	case mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MODIFY|syscall.IN_ATTRIB) != 0:
+		watcher.dispatch(Event{path, EventModified, isDir})
+	}
+}
+
+func trimNull(bytes []byte) []byte {
+	for index, b := range bytes {
+		if b == 0 {
+			return bytes[:index]
+		}
+	}
+	return bytes
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import "errors"
+
+func newInotifyWatcher([]string) (Watcher, error) {
+	return nil, errors.New("inotify is only available on linux")
+}
@@ -0,0 +1,88 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"segaline/src/util"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+type pollWatcher struct {
+	dispatcher
+
+	roots  []string
+	states map[string]fileState
+	done   chan struct{}
+}
+
+func newPollWatcher(roots []string) (*pollWatcher, error) {
+	watcher := &pollWatcher{roots: roots, done: make(chan struct{})}
+	states, err := watcher.scan()
+	if err != nil {
+		return nil, err
+	}
+	watcher.states = states
+
+	go watcher.run()
+	return watcher, nil
+}
+
+func (watcher *pollWatcher) Close() error {
+	close(watcher.done)
+	return nil
+}
+
+func (watcher *pollWatcher) run() {
+	ticker := time.NewTicker(util.DefaultWatchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-watcher.done:
+			return
+		case <-ticker.C:
+			states, err := watcher.scan()
+			if err == nil {
+				watcher.diff(states)
+				watcher.states = states
+			}
+		}
+	}
+}
+
+func (watcher *pollWatcher) scan() (map[string]fileState, error) {
+	states := map[string]fileState{}
+	for _, root := range watcher.roots {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err == nil {
+				states[path] = fileState{info.ModTime(), info.Size(), info.IsDir()}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+func (watcher *pollWatcher) diff(states map[string]fileState) {
+	for path, state := range states {
+		if old, ok := watcher.states[path]; !ok {
+			watcher.dispatch(Event{path, EventCreated, state.isDir})
+		} else if !state.isDir && (!old.modTime.Equal(state.modTime) || old.size != state.size) {
+			watcher.dispatch(Event{path, EventModified, false})
+		}
+	}
+	for path, old := range watcher.states {
+		if _, ok := states[path]; !ok {
+			watcher.dispatch(Event{path, EventRemoved, old.isDir})
+		}
+	}
+}
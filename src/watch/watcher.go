@@ -0,0 +1,57 @@
+package watch
+
+import (
+	"log"
+	"sync"
+)
+
+type EventKind int
+
+const (
+	EventCreated EventKind = iota
+	EventModified
+	EventRemoved
+	// Some events were lost, so anything below the roots may have changed. These events have no path.
+	EventOverflowed
+)
+
+type Event struct {
+	Path  string
+	Kind  EventKind
+	IsDir bool
+}
+
+type Watcher interface {
+	Subscribe(handler func(Event))
+	Close() error
+}
+
+// Creates a watcher for the given directory trees, using inotify where it is available, and polling otherwise.
+func NewWatcher(roots []string) (Watcher, error) {
+	watcher, err := newInotifyWatcher(roots)
+	if err == nil {
+		return watcher, nil
+	}
+
+	log.Println("Filesystem notifications are unavailable, so files will be polled for changes.")
+	return newPollWatcher(roots)
+}
+
+type dispatcher struct {
+	handlers []func(Event)
+	lock     sync.RWMutex
+}
+
+func (dispatcher *dispatcher) Subscribe(handler func(Event)) {
+	dispatcher.lock.Lock()
+	defer dispatcher.lock.Unlock()
+	dispatcher.handlers = append(dispatcher.handlers, handler)
+}
+
+func (dispatcher *dispatcher) dispatch(event Event) {
+	dispatcher.lock.RLock()
+	defer dispatcher.lock.RUnlock()
+	for _, handler := range dispatcher.handlers {
+		handler(event)
+	}
+}